@@ -0,0 +1,47 @@
+package pool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// scaler adjusts the MinIdle floor based on the miss rate of Get. It is only
+// used by the background loop.
+type scaler struct {
+	hits, misses uint64
+	sampled      time.Time
+}
+
+// MinIdle returns the current number of idle connections the pool attempts
+// to maintain. It equals Options.MinIdle, unless AutoScale is enabled.
+func (s *Of[T]) MinIdle() int { return int(atomic.LoadInt32(&s.minIdle)) }
+
+// autoscale samples the hit/miss counters once per window and raises the
+// MinIdle floor by one when the miss rate exceeds AutoScaleHigh, or lowers it
+// by one when it drops below AutoScaleLow. The floor stays between
+// Options.MinIdle and MaxCap.
+func (s *Of[T]) autoscale(now time.Time) {
+	if now.Sub(s.scaler.sampled) < s.opt.AutoScaleWindow {
+		return
+	}
+
+	hits, misses := atomic.LoadUint64(&s.hits), atomic.LoadUint64(&s.misses)
+	dHits, dMisses := hits-s.scaler.hits, misses-s.scaler.misses
+	s.scaler = scaler{hits: hits, misses: misses, sampled: now}
+
+	var rate float64
+	if total := dHits + dMisses; total != 0 {
+		rate = float64(dMisses) / float64(total)
+	}
+
+	floor := s.MinIdle()
+	switch {
+	case rate > s.opt.AutoScaleHigh && floor < s.MaxCap():
+		floor++
+	case rate < s.opt.AutoScaleLow && floor > s.opt.MinIdle:
+		floor--
+	default:
+		return
+	}
+	atomic.StoreInt32(&s.minIdle, int32(floor))
+}
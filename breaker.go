@@ -0,0 +1,58 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrCircuitOpen is returned by Get when the circuit breaker is open, see
+// Options.FailureThreshold.
+var ErrCircuitOpen = errors.New("pool: circuit open")
+
+// breaker is a circuit breaker around the factory. It opens after a number
+// of consecutive failures and allows a single trial dial once the cooldown
+// has passed.
+type breaker struct {
+	threshold int32
+	cooldown  time.Duration
+
+	failures  int32
+	openUntil int64 // unix nanos, 0 when closed
+	trial     int32
+}
+
+// Allow reports whether a dial may be attempted.
+func (b *breaker) Allow() bool {
+	until := atomic.LoadInt64(&b.openUntil)
+	if until == 0 {
+		return true
+	}
+	if time.Now().UnixNano() < until {
+		return false
+	}
+
+	// half-open, let a single trial through
+	return atomic.CompareAndSwapInt32(&b.trial, 0, 1)
+}
+
+// Record records the result of a dial.
+func (b *breaker) Record(err error) {
+	if err == nil {
+		atomic.StoreInt32(&b.failures, 0)
+		atomic.StoreInt64(&b.openUntil, 0)
+		atomic.StoreInt32(&b.trial, 0)
+		return
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		atomic.StoreInt32(&b.trial, 0)
+		return
+	}
+
+	n := atomic.AddInt32(&b.failures, 1)
+	if n >= b.threshold || atomic.LoadInt32(&b.trial) == 1 {
+		atomic.StoreInt64(&b.openUntil, time.Now().Add(b.cooldown).UnixNano())
+		atomic.StoreInt32(&b.trial, 0)
+	}
+}
@@ -0,0 +1,136 @@
+package pool
+
+import (
+	"log"
+	"net"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// PooledConn wraps a connection obtained from a Pool.
+type PooledConn struct {
+	net.Conn
+
+	pool     *Pool
+	err      error
+	unusable bool
+	released int32
+	mu       sync.Mutex
+}
+
+// countingConn counts the bytes transferred over a borrowed connection, see
+// Options.CountBytes.
+type countingConn struct {
+	net.Conn
+	pool *Of[net.Conn]
+}
+
+// Read implements net.Conn.
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(&c.pool.bytesRead, uint64(n))
+	return n, err
+}
+
+// Write implements net.Conn.
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(&c.pool.bytesWritten, uint64(n))
+	return n, err
+}
+
+// GetWrapped returns a wrapped connection from the pool or creates a new one.
+// The wrapper must be released after use.
+func (s *Pool) GetWrapped() (*PooledConn, error) {
+	cn, err := s.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &PooledConn{Conn: cn, pool: s}
+	if s.opt.LeakDetect {
+		stack := debug.Stack()
+		runtime.SetFinalizer(pc, func(pc *PooledConn) { pc.leaked(stack) })
+	}
+	return pc, nil
+}
+
+// Read implements net.Conn. Errors mark the connection as unusable.
+func (c *PooledConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.setErr(err)
+	return n, err
+}
+
+// Write implements net.Conn. Errors mark the connection as unusable.
+func (c *PooledConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.setErr(err)
+	return n, err
+}
+
+// Err returns the first read/write error encountered, if any.
+func (c *PooledConn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// MarkUnusable marks the connection as unusable. It will be closed on
+// Release instead of being returned to the pool.
+func (c *PooledConn) MarkUnusable() {
+	c.mu.Lock()
+	c.unusable = true
+	c.mu.Unlock()
+}
+
+// Release returns the connection to the pool, or closes it if it has been
+// marked as unusable. Subsequent calls are no-ops.
+func (c *PooledConn) Release() error {
+	if !atomic.CompareAndSwapInt32(&c.released, 0, 1) {
+		return nil
+	}
+	if c.pool.opt.LeakDetect {
+		runtime.SetFinalizer(c, nil)
+	}
+
+	c.mu.Lock()
+	unusable := c.unusable || c.err != nil
+	c.mu.Unlock()
+
+	if unusable {
+		return c.pool.drop(c.Conn)
+	}
+	c.pool.Put(c.Conn)
+	return nil
+}
+
+// leaked is called by the finalizer of a connection that was garbage
+// collected without being released.
+func (c *PooledConn) leaked(stack []byte) {
+	if !atomic.CompareAndSwapInt32(&c.released, 0, 1) {
+		return
+	}
+
+	const msg = "pool: connection garbage collected without Release, checked out at:\n%s"
+	if logger := c.pool.opt.Logger; logger != nil {
+		logger.Printf(msg, stack)
+	} else {
+		log.Printf(msg, stack)
+	}
+	_ = c.pool.drop(c.Conn)
+}
+
+func (c *PooledConn) setErr(err error) {
+	if err == nil {
+		return
+	}
+
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+}
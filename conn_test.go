@@ -0,0 +1,181 @@
+package pool_test
+
+import (
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bsm/pool"
+)
+
+func TestPooledConn(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(nil, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	t.Run("release", func(t *testing.T) {
+		cn, err := p.GetWrapped()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := cn.Release(); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if exp, got := 1, p.Len(); exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+
+		// double release is safe
+		if err := cn.Release(); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if exp, got := 1, p.Len(); exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+	})
+
+	t.Run("unusable", func(t *testing.T) {
+		cn, err := p.GetWrapped()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cn.MarkUnusable()
+		if err := cn.Release(); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if exp, got := 0, p.Len(); exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+		if _, err := cn.Conn.Write([]byte("x")); err == nil {
+			t.Error("expected connection to be closed")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		cn, err := p.GetWrapped()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		_ = cn.Conn.Close()
+		if _, err := cn.Write([]byte("x")); err == nil {
+			t.Fatal("expected error")
+		}
+		if cn.Err() == nil {
+			t.Error("expected error to be recorded")
+		}
+		_ = cn.Release()
+		if exp, got := 0, p.Len(); exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+	})
+}
+
+func TestPool_CountBytes(t *testing.T) {
+	addr, closeServer := echoServer(t, "tcp", "127.0.0.1:0")
+	defer closeServer()
+
+	p, err := pool.NewTCP(addr, &pool.Options{CountBytes: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	for i := 0; i < 2; i++ {
+		cn, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := cn.Write([]byte("hello")); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := io.ReadFull(cn, make([]byte, 5)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !p.Put(cn) {
+			t.Fatal("expected true")
+		}
+	}
+
+	st := p.Stats()
+	if exp, got := uint64(10), st.BytesWritten; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := uint64(10), st.BytesRead; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// the same underlying connection is re-pooled
+	if exp, got := uint64(1), st.Hits; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPooledConn_LeakDetect(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	logs := make(chan string, 1)
+	log.SetOutput(logWriter(logs))
+	defer log.SetOutput(os.Stderr)
+
+	p, err := pool.New(&pool.Options{
+		MaxActive:  1,
+		LeakDetect: true,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	func() {
+		if _, err := p.GetWrapped(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}()
+
+	var msg string
+	for deadline := time.Now().Add(time.Second); msg == "" && time.Now().Before(deadline); {
+		runtime.GC()
+		select {
+		case msg = <-logs:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if !strings.Contains(msg, "without Release") {
+		t.Fatalf("expected leak warning, got %q", msg)
+	}
+	if !strings.Contains(msg, "TestPooledConn_LeakDetect") {
+		t.Errorf("expected call site in %q", msg)
+	}
+
+	// the MaxActive slot is freed again
+	cn, err := p.GetWrapped()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := cn.Release(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+type logWriter chan string
+
+func (w logWriter) Write(p []byte) (int, error) {
+	select {
+	case w <- string(p):
+	default:
+	}
+	return len(p), nil
+}
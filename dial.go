@@ -0,0 +1,138 @@
+package pool
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync/atomic"
+)
+
+// NewTCP creates a pool of TCP connections to addr. Connections are dialed
+// with the configured DialTimeout and KeepAlive.
+func NewTCP(addr string, opt *Options) (*Pool, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, err
+	}
+	return newDialer("tcp", addr, opt)
+}
+
+// NewUnix creates a pool of connections to the Unix domain socket at path.
+// Connections are dialed with the configured DialTimeout.
+func NewUnix(path string, opt *Options) (*Pool, error) {
+	if path == "" {
+		return nil, errors.New("pool: empty socket path")
+	}
+	return newDialer("unix", path, opt)
+}
+
+// NewTLS creates a pool of TLS connections to addr. Connections are dialed
+// and handshaked within DialTimeout, so only fully established connections
+// are pooled.
+func NewTLS(addr string, cfg *tls.Config, opt *Options) (*Pool, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, err
+	}
+
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	if o.FactoryContext == nil {
+		o.FactoryContext = TLSFactory(addr, cfg, &o)
+	}
+	return New(&o, nil)
+}
+
+// TLSFactory returns a factory which dials addr via TCP and performs the TLS
+// handshake, applying the DialTimeout and KeepAlive options. If cfg has no
+// ServerName, the host of addr is used. Connections that fail the handshake
+// are closed.
+func TLSFactory(addr string, cfg *tls.Config, opt *Options) FactoryContext {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+
+	if cfg == nil {
+		cfg = new(tls.Config)
+	}
+	if cfg.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			cfg = cfg.Clone()
+			cfg.ServerName = host
+		}
+	}
+
+	dial := DialFactory("tcp", addr, &o)
+	return func(ctx context.Context) (net.Conn, error) {
+		if o.DialTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, o.DialTimeout)
+			defer cancel()
+		}
+
+		cn, err := dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		tc := tls.Client(cn, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			_ = cn.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+}
+
+// DialFactory returns a factory which dials addr on the named network,
+// applying the DialTimeout and KeepAlive options.
+func DialFactory(network, addr string, opt *Options) FactoryContext {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   o.DialTimeout,
+		KeepAlive: o.KeepAlive,
+	}
+	return func(ctx context.Context) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// RoundRobinFactory returns a factory which cycles through addrs, using a
+// different address on each call. If dialing an address fails, the next one
+// is tried; an error is only returned once all addresses have failed.
+func RoundRobinFactory(addrs []string, dial func(addr string) (net.Conn, error)) Factory {
+	var next uint32
+	return func() (net.Conn, error) {
+		if len(addrs) == 0 {
+			return nil, errors.New("pool: no addresses")
+		}
+
+		start := int(atomic.AddUint32(&next, 1) - 1)
+		errs := make([]error, 0, len(addrs))
+		for i := range addrs {
+			cn, err := dial(addrs[(start+i)%len(addrs)])
+			if err == nil {
+				return cn, nil
+			}
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	}
+}
+
+func newDialer(network, addr string, opt *Options) (*Pool, error) {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	if o.FactoryContext == nil {
+		o.FactoryContext = DialFactory(network, addr, &o)
+	}
+	return New(&o, nil)
+}
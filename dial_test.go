@@ -0,0 +1,267 @@
+package pool_test
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bsm/pool"
+)
+
+func TestNewTCP(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer lis.Close()
+
+	p, err := pool.NewTCP(lis.Addr().String(), &pool.Options{
+		InitialSize: 2,
+		DialTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if exp, got := 2, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestNewTCP_KeepAlive(t *testing.T) {
+	addr, stop := echoServer(t, "tcp", "127.0.0.1:0")
+	defer stop()
+
+	p, err := pool.NewTCP(addr, &pool.Options{
+		KeepAlive: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Put(cn)
+
+	assertRoundTrip(t, cn)
+}
+
+func TestNewTCP_badAddr(t *testing.T) {
+	if _, err := pool.NewTCP("not an address", nil); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestNewTCP_timeout(t *testing.T) {
+	// 100::/64 is a discard-only prefix, see RFC 6666
+	p, err := pool.NewTCP("[100::1]:80", &pool.Options{
+		DialTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	start := time.Now()
+	if cn, err := p.Get(); err == nil {
+		_ = cn.Close()
+		t.Skip("network does not discard non-routable addresses")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected dial to time out, took %v", elapsed)
+	}
+}
+
+func TestNewUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pool.sock")
+	_, closeServer := echoServer(t, "unix", path)
+	defer closeServer()
+
+	p, err := pool.NewUnix(path, &pool.Options{
+		DialTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	assertRoundTrip(t, cn)
+	p.Put(cn)
+
+	cn, err = p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	assertRoundTrip(t, cn)
+	p.Put(cn)
+}
+
+func TestNewUnix_badPath(t *testing.T) {
+	if _, err := pool.NewUnix("", nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestNewTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := server.Client().Transport.(*http.Transport).TLSClientConfig
+	p, err := pool.NewTLS(server.Listener.Addr().String(), cfg, &pool.Options{
+		DialTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cn.Close()
+
+	tc, ok := cn.(*tls.Conn)
+	if !ok {
+		t.Fatalf("expected *tls.Conn, got %T", cn)
+	}
+	if !tc.ConnectionState().HandshakeComplete {
+		t.Error("expected handshake to be complete")
+	}
+}
+
+func TestNewTLS_handshakeError(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	// the server certificate is not trusted
+	p, err := pool.NewTLS(server.Listener.Addr().String(), nil, &pool.Options{
+		DialTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if _, err := p.Get(); err == nil {
+		t.Fatal("expected error")
+	}
+	if exp, got := 0, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestNewTLS_badAddr(t *testing.T) {
+	if _, err := pool.NewTLS("localhost", nil, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestRoundRobinFactory(t *testing.T) {
+	addr1, close1 := echoServer(t, "tcp", "127.0.0.1:0")
+	defer close1()
+	addr2, close2 := echoServer(t, "tcp", "127.0.0.1:0")
+	defer close2()
+
+	// reserve an address and close it again, so nobody listens
+	down, closeDown := echoServer(t, "tcp", "127.0.0.1:0")
+	closeDown()
+
+	var mu sync.Mutex
+	var dialed []string
+	factory := pool.RoundRobinFactory([]string{addr1, down, addr2}, func(addr string) (net.Conn, error) {
+		mu.Lock()
+		dialed = append(dialed, addr)
+		mu.Unlock()
+		return net.Dial("tcp", addr)
+	})
+
+	var got []string
+	for i := 0; i < 3; i++ {
+		cn, err := factory()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		got = append(got, cn.RemoteAddr().String())
+		_ = cn.Close()
+	}
+
+	// the down address is skipped in favour of the next one
+	if exp := []string{addr1, addr2, addr2}; !reflect.DeepEqual(exp, got) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp := []string{addr1, down, addr2, addr2}; !reflect.DeepEqual(exp, dialed) {
+		t.Errorf("expected %v, got %v", exp, dialed)
+	}
+}
+
+func TestRoundRobinFactory_allDown(t *testing.T) {
+	down, closeDown := echoServer(t, "tcp", "127.0.0.1:0")
+	closeDown()
+
+	factory := pool.RoundRobinFactory([]string{down, down}, func(addr string) (net.Conn, error) {
+		return net.Dial("tcp", addr)
+	})
+	if _, err := factory(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if _, err := pool.RoundRobinFactory(nil, nil)(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func echoServer(t *testing.T, network, addr string) (string, func()) {
+	t.Helper()
+
+	lis, err := net.Listen(network, addr)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	go func() {
+		for {
+			cn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer cn.Close()
+				_, _ = io.Copy(cn, cn)
+			}()
+		}
+	}()
+	return lis.Addr().String(), func() { _ = lis.Close() }
+}
+
+func assertRoundTrip(t *testing.T, cn net.Conn) {
+	t.Helper()
+
+	if _, err := cn.Write([]byte{'x'}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(cn, buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := byte('x'), buf[0]; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
@@ -0,0 +1,78 @@
+package pool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// EventKind identifies the type of an Event.
+type EventKind uint8
+
+// Event kinds.
+const (
+	// EventCreated is emitted when a new connection is created.
+	EventCreated EventKind = iota + 1
+	// EventBorrowed is emitted when Get hands out a connection.
+	EventBorrowed
+	// EventReturned is emitted when a connection is returned via Put.
+	EventReturned
+	// EventReaped is emitted when an idle connection is reaped.
+	EventReaped
+	// EventClosed is emitted whenever the pool closes a connection.
+	EventClosed
+	// EventHealthCheckFailed is emitted when a connection fails HealthCheck.
+	EventHealthCheckFailed
+)
+
+// String returns the name of the kind.
+func (k EventKind) String() string {
+	switch k {
+	case EventCreated:
+		return "created"
+	case EventBorrowed:
+		return "borrowed"
+	case EventReturned:
+		return "returned"
+	case EventReaped:
+		return "reaped"
+	case EventClosed:
+		return "closed"
+	case EventHealthCheckFailed:
+		return "health-check-failed"
+	}
+	return "unknown"
+}
+
+// Event describes a connection lifecycle event.
+type Event struct {
+	Kind EventKind
+	Time time.Time
+}
+
+// eventsBuffer is the capacity of the events channel.
+const eventsBuffer = 64
+
+// Events returns a channel of lifecycle events. Events are only emitted once
+// Events has been called, all calls return the same channel. Events are
+// dropped instead of blocking the pool when the channel is full, see
+// Stats.DroppedEvents. The channel is never closed.
+func (s *Of[T]) Events() <-chan Event {
+	s.eventsOnce.Do(func() {
+		s.events = make(chan Event, eventsBuffer)
+		atomic.StoreInt32(&s.subscribed, 1)
+	})
+	return s.events
+}
+
+// emit sends an event to the subscriber, if any.
+func (s *Of[T]) emit(kind EventKind) {
+	if atomic.LoadInt32(&s.subscribed) == 0 {
+		return
+	}
+
+	select {
+	case s.events <- Event{Kind: kind, Time: time.Now()}:
+	default:
+		atomic.AddUint64(&s.droppedEvents, 1)
+	}
+}
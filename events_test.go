@@ -0,0 +1,73 @@
+package pool_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bsm/pool"
+)
+
+func TestOf_Events(t *testing.T) {
+	p, err := pool.NewOf(nil, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	// no events before subscribing
+	c, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p.Put(c)
+
+	events := p.Events()
+	if events != p.Events() {
+		t.Error("expected the same channel")
+	}
+
+	c, err = p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p.Put(c)
+
+	var kinds []pool.EventKind
+	for len(kinds) < 2 {
+		select {
+		case ev := <-events:
+			if ev.Time.IsZero() {
+				t.Error("expected event time")
+			}
+			kinds = append(kinds, ev.Kind)
+		case <-time.After(time.Second):
+			t.Fatalf("expected events, got %v", kinds)
+		}
+	}
+	if exp := []pool.EventKind{pool.EventBorrowed, pool.EventReturned}; !reflect.DeepEqual(exp, kinds) {
+		t.Errorf("expected %v, got %v", exp, kinds)
+	}
+}
+
+func TestOf_Events_dropped(t *testing.T) {
+	p, err := pool.NewOf(nil, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	_ = p.Events()
+	for i := 0; i < 50; i++ {
+		c, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		p.Put(c)
+	}
+
+	// 1 created, 50 borrowed, 50 returned; 64 buffered
+	if exp, got := uint64(37), p.Stats().DroppedEvents; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
@@ -0,0 +1,11 @@
+package pool
+
+import (
+	"io"
+	"time"
+)
+
+// SetClock replaces the clock of pools created with the options.
+func SetClock[T io.Closer](opt *OptionsOf[T], now func() time.Time) {
+	opt.now = now
+}
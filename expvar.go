@@ -0,0 +1,10 @@
+package pool
+
+import "expvar"
+
+// PublishExpvar publishes the pool Stats under the given name, to be served
+// as JSON by the expvar handler. Like expvar.Publish, it panics if the name
+// is already registered.
+func (s *Of[T]) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return s.Stats() }))
+}
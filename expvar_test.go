@@ -0,0 +1,50 @@
+package pool_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bsm/pool"
+)
+
+// expvarSeq keeps published names unique, expvar.Publish panics on
+// duplicates when tests are run repeatedly.
+var expvarSeq int32
+
+func TestOf_PublishExpvar(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize: 2,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	name := fmt.Sprintf("pool_test_stats_%d", atomic.AddInt32(&expvarSeq, 1))
+	p.PublishExpvar(name)
+	if _, err := p.Get(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	v := expvar.Get(name)
+	if v == nil {
+		t.Fatal("expected the var to be published")
+	}
+
+	var st pool.Stats
+	if err := json.Unmarshal([]byte(v.String()), &st); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 1, st.Idle; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 1, st.Active; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := uint64(1), st.Hits; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
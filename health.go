@@ -0,0 +1,139 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Ping verifies that the backend is reachable. If HealthCheck is configured,
+// it borrows a connection, checks it and returns it to the pool. Otherwise,
+// Ping dials a fresh connection and adds it to the pool. When MaxActive is
+// reached, Ping queues like Get does and makes room by closing the oldest
+// idle connection.
+func (s *Of[T]) Ping(ctx context.Context) error {
+	if s.opt.HealthCheck == nil {
+		cn, _, _, err := s.get(ctx, func(T) bool { return false }, 0)
+		if err != nil {
+			return err
+		}
+		s.Put(cn)
+		return nil
+	}
+
+	cn, err := s.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.opt.HealthCheck(cn); err != nil {
+		_ = s.drop(cn)
+		return err
+	}
+	s.Put(cn)
+	return nil
+}
+
+// healthCheck runs HealthCheck on all idle connections. Each connection is
+// removed from the idle list while it is being checked, so it can't be handed
+// out concurrently, and restored if it passes. It returns the number of
+// evicted connections.
+func (s *Of[T]) healthCheck() int {
+	return s.checkIdle(s.opt.HealthCheck, func(err error) {
+		s.logf("pool: health check failed, closing connection: %v", err)
+		s.emit(EventHealthCheckFailed)
+	})
+}
+
+// checkIdle runs check on all idle connections, see healthCheck. Failing
+// connections are closed, after calling onFail. It returns the number of
+// failed connections.
+func (s *Of[T]) checkIdle(check func(cn T) error, onFail func(err error)) int {
+	var conns []T
+	for i := range s.shards {
+		conns = append(conns, s.shards[i].snapshot()...)
+	}
+
+	failed := 0
+	for _, cn := range conns {
+		m, ok := s.remove(cn)
+		if !ok {
+			continue // checked out meanwhile
+		}
+
+		if err := check(cn); err != nil {
+			onFail(err)
+			_ = s.discard(cn)
+			failed++
+			continue
+		}
+		s.restore(m)
+	}
+	return failed
+}
+
+// prober is implemented by connections that support ProbeOnReap.
+type prober interface {
+	Read(b []byte) (int, error)
+	SetReadDeadline(t time.Time) error
+}
+
+// errUnexpectedRead is returned by probe when an idle connection has
+// unread data.
+var errUnexpectedRead = errors.New("pool: unexpected read on idle connection")
+
+// probe checks whether the peer has closed an idle connection, by attempting
+// a read that times out almost immediately. A timeout means the connection is
+// alive, EOF or any other error means it is gone. Connections that don't
+// support deadlines are considered alive.
+func probe[T io.Closer](cn T) error {
+	c, ok := any(cn).(prober)
+	if !ok {
+		return nil
+	}
+
+	// an expired deadline fails without reading, allow a short wait instead
+	if err := c.SetReadDeadline(time.Now().Add(time.Millisecond)); err != nil {
+		return err
+	}
+
+	var buf [1]byte
+	n, err := c.Read(buf[:])
+	if n != 0 {
+		return errUnexpectedRead
+	}
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return c.SetReadDeadline(time.Time{})
+}
+
+// remove removes a specific connection from the idle list.
+func (s *Of[T]) remove(cn T) (member[T], bool) {
+	for i := range s.shards {
+		if m, ok := s.shards[i].remove(cn); ok {
+			atomic.AddInt32(&s.size, -1)
+			return m, true
+		}
+	}
+	return member[T]{}, false
+}
+
+// restore re-inserts a previously removed member into the idle list,
+// preserving the order by lastAccess.
+func (s *Of[T]) restore(m member[T]) {
+	if atomic.LoadInt32(&s.closed) == 1 || atomic.LoadInt32(&s.draining) == 1 || !s.reserve() {
+		_ = s.discard(m.cn)
+		return
+	}
+
+	if s.stash(m, true) {
+		return
+	}
+	s.notifyIdle()
+}
@@ -0,0 +1,301 @@
+package pool_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bsm/pool"
+)
+
+func TestOf_HealthCheck(t *testing.T) {
+	items := []*mockCloser{new(mockCloser), new(mockCloser), new(mockCloser)}
+	unhealthy := items[1]
+
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		HealthCheck: func(c *mockCloser) error {
+			if c == unhealthy {
+				return errors.New("unhealthy")
+			}
+			return nil
+		},
+		HealthCheckInterval: 10 * time.Millisecond,
+	}, func() (*mockCloser, error) {
+		return new(mockCloser), nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	for _, c := range items {
+		p.Put(c)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if exp, got := 2, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if !unhealthy.IsClosed() {
+		t.Error("expected unhealthy item to be closed")
+	}
+
+	// remaining items are handed out in order
+	for _, exp := range []*mockCloser{items[2], items[0]} {
+		c, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if c != exp {
+			t.Error("expected idle order to be preserved")
+		}
+		if c.IsClosed() {
+			t.Error("expected healthy item to be open")
+		}
+	}
+}
+
+func TestOf_HealthCheck_MinIdle(t *testing.T) {
+	var created int32
+	var unhealthy atomic.Value
+	unhealthy.Store((*mockCloser)(nil))
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize: 3,
+		MinIdle:     3,
+		HealthCheck: func(c *mockCloser) error {
+			if c == unhealthy.Load().(*mockCloser) {
+				return errors.New("unhealthy")
+			}
+			return nil
+		},
+		HealthCheckInterval: 10 * time.Millisecond,
+		ReapInterval:        time.Hour,
+	}, func() (*mockCloser, error) {
+		atomic.AddInt32(&created, 1)
+		return new(mockCloser), nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	c, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	unhealthy.Store(c)
+	p.Put(c)
+
+	time.Sleep(50 * time.Millisecond)
+	if !c.IsClosed() {
+		t.Error("expected unhealthy item to be closed")
+	}
+	if exp, got := 3, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := int32(4), atomic.LoadInt32(&created); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_Ping(t *testing.T) {
+	addr, closeServer := echoServer(t, "tcp", "127.0.0.1:0")
+
+	p, err := pool.NewTCP(addr, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	ctx := context.Background()
+	if err := p.Ping(ctx); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	closeServer()
+	if err := p.Ping(ctx); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestOf_Ping_MaxActive(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MaxActive: 1,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// queues for the slot of the returned connection
+	errs := make(chan error, 1)
+	go func() { errs <- p.Ping(context.Background()) }()
+	for p.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	p.Put(cn)
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Ping to complete")
+	}
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if atomic.LoadInt32(&cn.closed) == 0 {
+		t.Error("expected the returned connection to be replaced")
+	}
+
+	// woken up by Close
+	if cn, err = p.Get(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	go func() { errs <- p.Ping(context.Background()) }()
+	for p.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	_ = p.Close()
+
+	select {
+	case err := <-errs:
+		if err != pool.ErrPoolClosed {
+			t.Errorf("expected %v, got %v", pool.ErrPoolClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Ping to be woken up by Close")
+	}
+	p.Put(cn)
+}
+
+func TestOf_Ping_HealthCheck(t *testing.T) {
+	var healthy int32 = 1
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize: 1,
+		HealthCheck: func(c *mockCloser) error {
+			if atomic.LoadInt32(&healthy) == 0 {
+				return errors.New("unhealthy")
+			}
+			return nil
+		},
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	ctx := context.Background()
+	if err := p.Ping(ctx); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	atomic.StoreInt32(&healthy, 0)
+	if err := p.Ping(ctx); err == nil || err.Error() != "unhealthy" {
+		t.Errorf("expected unhealthy, got %v", err)
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 0, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_ProbeOnReap(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer lis.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			cn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- cn
+		}
+	}()
+
+	p, err := pool.NewTCP(lis.Addr().String(), &pool.Options{
+		ProbeOnReap:  true,
+		ReapInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn1, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cn2, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p.Put(cn1)
+	p.Put(cn2)
+
+	// close one of the connections server-side
+	peer := <-accepted
+	defer (<-accepted).Close()
+	_ = peer.Close()
+
+	time.Sleep(50 * time.Millisecond)
+
+	// stop reaping, connections are off the idle list while being probed
+	p.SetReapInterval(time.Hour)
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := uint64(1), p.Stats().Reaped; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// the surviving connection is still usable
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := cn.Write([]byte("x")); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	p.Put(cn)
+}
+
+func TestOf_ProbeOnReap_nonConn(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		ProbeOnReap:  true,
+		ReapInterval: 5 * time.Millisecond,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	p.Put(new(mockCloser))
+	time.Sleep(30 * time.Millisecond)
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
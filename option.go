@@ -0,0 +1,36 @@
+package pool
+
+import "time"
+
+// Option configures a Pool created by NewWithOptions.
+type Option func(*Options)
+
+// NewWithOptions creates a pool like New, configured by functional options.
+// Options are applied in order, unset values fall back to the defaults.
+func NewWithOptions(factory Factory, opts ...Option) (*Pool, error) {
+	opt := new(Options)
+	for _, fn := range opts {
+		fn(opt)
+	}
+	return New(opt, factory)
+}
+
+// WithInitialSize sets Options.InitialSize.
+func WithInitialSize(n int) Option {
+	return func(o *Options) { o.InitialSize = n }
+}
+
+// WithMaxCap sets Options.MaxCap.
+func WithMaxCap(n int) Option {
+	return func(o *Options) { o.MaxCap = n }
+}
+
+// WithMaxActive sets Options.MaxActive.
+func WithMaxActive(n int) Option {
+	return func(o *Options) { o.MaxActive = n }
+}
+
+// WithIdleTimeout sets Options.IdleTimeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *Options) { o.IdleTimeout = d }
+}
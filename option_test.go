@@ -0,0 +1,109 @@
+package pool_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bsm/pool"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.NewWithOptions(factory,
+		pool.WithInitialSize(2),
+		pool.WithMaxCap(4),
+		pool.WithIdleTimeout(time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if exp, got := 2, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 4, p.MaxCap(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestNewWithOptions_defaults(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.NewWithOptions(factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 10, p.MaxCap(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestNewWithOptions_norm(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	// MaxCap is raised to InitialSize
+	p, err := pool.NewWithOptions(factory, pool.WithInitialSize(3), pool.WithMaxCap(1))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 3, p.MaxCap(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	p.Close()
+
+	// MaxCap is lowered to MaxActive
+	p, err = pool.NewWithOptions(factory, pool.WithMaxActive(2), pool.WithMaxCap(8))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 2, p.MaxCap(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	p.Close()
+
+	// later options win
+	p, err = pool.NewWithOptions(factory, pool.WithMaxCap(2), pool.WithMaxCap(6))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 6, p.MaxCap(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	p.Close()
+}
+
+func TestWithMaxActive(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.NewWithOptions(factory, pool.WithMaxActive(1))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := p.GetContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
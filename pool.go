@@ -1,39 +1,371 @@
 // Package pool is a generic, high-performance pool for net.Conn
-// objects.
+// and other io.Closer objects.
 package pool
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"reflect"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// ErrPoolDraining is returned by Get when the pool is being drained.
+var ErrPoolDraining = errors.New("pool: draining")
+
+// ErrPoolClosed is returned by Get when the pool is closed.
+var ErrPoolClosed = errors.New("pool: closed")
+
+// ErrPoolExhausted is returned by Get when MaxActive is reached and NoWait
+// is set, or WaitTimeout has elapsed.
+var ErrPoolExhausted = errors.New("pool: exhausted")
+
+// ErrTooManyWaiters is returned by Get when MaxActive is reached and
+// MaxWaiters callers are already waiting.
+var ErrTooManyWaiters = errors.New("pool: too many waiters")
+
+// ErrCloseTimeout is returned when closing a connection takes longer than
+// CloseTimeout.
+var ErrCloseTimeout = errors.New("pool: close timed out")
+
+// ErrFactoryPanic is returned when the factory panics.
+var ErrFactoryPanic = errors.New("pool: factory panic")
+
+// ErrNilConn is returned when the factory returns neither a connection nor
+// an error.
+var ErrNilConn = errors.New("pool: factory returned nil")
+
+// Logger is the interface used for logging, it is satisfied by *log.Logger.
+type Logger interface {
+	Printf(format string, args ...any)
+}
+
 // Factory must returns new connections
-type Factory func() (net.Conn, error)
+type Factory = FactoryOf[net.Conn]
+
+// FactoryContext must returns new connections, honouring the context
+type FactoryContext = FactoryContextOf[net.Conn]
+
+// FactoryInfo must returns new connections and their metadata
+type FactoryInfo = FactoryInfoOf[net.Conn]
 
 // Options can tweak Pool configuration
-type Options struct {
-	// InitialSize creates a number of connection on pool initialization
+type Options = OptionsOf[net.Conn]
+
+// Pool contains a number of connections
+type Pool struct {
+	*Of[net.Conn]
+}
+
+// New creates a pool with an initial number of connection and a maximum cap
+func New(opt *Options, factory Factory) (*Pool, error) {
+	return NewContext(context.Background(), opt, factory)
+}
+
+// NewContext creates a pool like New. The initial connections are dialed
+// under the context; if it is cancelled, dialing stops and all connections
+// created so far are closed.
+func NewContext(ctx context.Context, opt *Options, factory Factory) (*Pool, error) {
+	p, err := NewOfContext(ctx, opt, factory)
+	if err != nil {
+		return nil, err
+	}
+	if p.opt.CountBytes {
+		p.wrap = func(cn net.Conn) net.Conn { return &countingConn{Conn: cn, pool: p} }
+		p.unwrap = func(cn net.Conn) net.Conn {
+			if cc, ok := cn.(*countingConn); ok {
+				return cc.Conn
+			}
+			return cn
+		}
+	}
+	return &Pool{Of: p}, nil
+}
+
+// NewPassthrough creates a pool that doesn't pool: Get always dials a new
+// connection and Put always closes it, so Len is always 0. This is useful
+// in tests and to rule out pooling when debugging.
+func NewPassthrough(factory Factory) *Pool {
+	p, _ := New(nil, factory) // without InitialSize, New can't fail
+	atomic.StoreInt32(&p.maxCap, 0)
+	return p
+}
+
+// FactoryOf must returns new items
+type FactoryOf[T io.Closer] func() (T, error)
+
+// FactoryContextOf must returns new items, honouring the context
+type FactoryContextOf[T io.Closer] func(context.Context) (T, error)
+
+// FactoryInfoOf must returns new items and their metadata, honouring the
+// context
+type FactoryInfoOf[T io.Closer] func(context.Context) (T, ConnInfo, error)
+
+// ConnInfo holds metadata attached to a connection by FactoryInfo, such as
+// the address of the backend. It is retrievable via Info while the
+// connection is checked out.
+type ConnInfo map[string]any
+
+// OptionsOf can tweak Of configuration
+type OptionsOf[T io.Closer] struct {
+	// InitialSize creates a number of connection on pool initialization.
+	// It is independent of MinIdle: when smaller, the pool is topped up to
+	// MinIdle on the first reap cycle, when larger, the surplus is subject
+	// to IdleTimeout like any other connection. Will be automatically
+	// adjusted when MaxActive is smaller.
 	// Default: 0
 	InitialSize int
 
-	// MaxCap sets the maximum pool capacity. Will be automatically adjusted when InitialSize
-	// is larger.
+	// LazyInit defers dialing the InitialSize connections from pool creation
+	// to the first Get. The first Get dials as usual, the remaining
+	// connections are dialed in the background. Factory errors are logged
+	// rather than returned by New.
+	// Default: false
+	LazyInit bool
+
+	// MaxCap sets the maximum pool capacity, i.e. the maximum number of idle
+	// connections retained. Connections returned via Put while the pool is at
+	// capacity are closed, regardless of MaxActive. Will be automatically
+	// adjusted when InitialSize is larger or MaxActive is smaller; the
+	// effective value is reported by Of.MaxCap, the Options passed to New are
+	// not modified.
 	// Default: 10
 	MaxCap int
 
+	// MinIdle is the number of idle connections the pool attempts to
+	// maintain. The pool is topped up on every reap cycle and IdleTimeout
+	// never reaps below it, connections exceeding MaxLifetime are still
+	// closed. Will be automatically adjusted when MaxCap is smaller.
+	// Default: 0
+	MinIdle int
+
+	// AutoScale enables dynamic adjustment of the MinIdle floor. The floor
+	// is raised when the share of Get calls that had to dial exceeds
+	// AutoScaleHigh and lowered again, never below MinIdle, when it drops
+	// below AutoScaleLow.
+	// Default: false
+	AutoScale bool
+
+	// AutoScaleWindow is the sampling window for AutoScale.
+	// Default: ReapInterval
+	AutoScaleWindow time.Duration
+
+	// AutoScaleHigh is the miss rate above which AutoScale grows the floor.
+	// Default: 0.1
+	AutoScaleHigh float64
+
+	// AutoScaleLow is the miss rate below which AutoScale shrinks the floor.
+	// Default: 0.01
+	AutoScaleLow float64
+
+	// MaxActive limits the total number of connections, checked-out plus
+	// idle. When the limit is reached, Get blocks until a connection is
+	// returned or discarded; blocked callers are served in arrival order.
+	// Unlike MaxCap, which only limits how many idle connections are kept,
+	// MaxActive limits how many may exist at all. It is never raised; a
+	// larger InitialSize is reduced instead. Connections not created by the
+	// pool don't hold a MaxActive slot, enable StrictOwnership to keep Put
+	// from adding them.
+	// Default: 0 (= unlimited)
+	MaxActive int
+
+	// NoWait makes Get return ErrPoolExhausted instead of blocking when
+	// MaxActive is reached.
+	// Default: false
+	NoWait bool
+
+	// WaitTimeout limits how long Get blocks when MaxActive is reached,
+	// before it returns ErrPoolExhausted. It does not apply to GetContext,
+	// use a context deadline instead.
+	// Default: 0 (= wait forever)
+	WaitTimeout time.Duration
+
+	// MaxWaiters limits the number of callers blocked in Get when MaxActive
+	// is reached. Further calls fail with ErrTooManyWaiters immediately.
+	// Default: 0 (= unlimited)
+	MaxWaiters int
+
+	// CloseTimeout limits how long closing a single connection may take.
+	// Connections that support deadlines are given one before being closed,
+	// a Close call still running after the timeout is abandoned and reported
+	// as ErrCloseTimeout.
+	// Default: 0 (= no limit)
+	CloseTimeout time.Duration
+
+	// CountBytes wraps borrowed connections to count the bytes read and
+	// written, reported as Stats.BytesRead and Stats.BytesWritten. The
+	// wrapper is removed again on Put. Only supported by Pool, it has no
+	// effect on other instances of Of.
+	// Default: false
+	CountBytes bool
+
+	// StrictOwnership makes the pool remember the connections it created.
+	// Connections it did not create are closed by Put instead of being
+	// pooled, and Put returns false.
+	// Default: false
+	StrictOwnership bool
+
+	// PrewarmOnDrain dials a replacement in the background whenever Get
+	// hands out the last idle connection, so the next caller doesn't have to
+	// wait for a dial.
+	// Default: false
+	PrewarmOnDrain bool
+
 	// IdleTimeout timeout after which connections are reaped and
 	// automatically removed from the pool.
 	// Default: 0 (= never)
 	IdleTimeout time.Duration
 
-	// ReapInterval determines the frequency of reap cycles
+	// MaxLifetime is the maximum amount of time a connection may be
+	// reused, measured from the moment it was created by the factory.
+	// Expired connections are reaped and discarded on Get/Put.
+	// Default: 0 (= forever)
+	MaxLifetime time.Duration
+
+	// FactoryContext is an optional, context-aware factory. When set, it
+	// is used instead of the plain factory, allowing GetContext to abort dials.
+	FactoryContext FactoryContextOf[T]
+
+	// FactoryInfo is an optional factory that attaches metadata to the
+	// connections it creates, see ConnInfo. When set, it is used instead of
+	// FactoryContext and the plain factory.
+	FactoryInfo FactoryInfoOf[T]
+
+	// DialTimeout is the timeout used by the built-in dial helpers, such as
+	// NewTCP.
+	// Default: 0 (= no timeout)
+	DialTimeout time.Duration
+
+	// MaxUses is the maximum number of times a connection may be handed
+	// out by Get. Connections that have been used up are discarded.
+	// Default: 0 (= unlimited)
+	MaxUses int
+
+	// KeepAlive specifies the keep-alive period for TCP connections created by
+	// the built-in dial helpers. Negative values disable keep-alives.
+	// Default: 0 (= system default, see net.Dialer)
+	KeepAlive time.Duration
+
+	// MaxRetries is the number of times a failed dial is retried before
+	// Get gives up. Context errors are never retried.
+	// Default: 0
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry, doubled with every
+	// subsequent attempt.
+	// Default: 10ms
+	RetryBackoff time.Duration
+
+	// FailureThreshold enables a circuit breaker around the factory. After
+	// the given number of consecutive failed dials, Get fails fast with
+	// ErrCircuitOpen for BreakerCooldown, after which a single trial dial
+	// is allowed to close the circuit again.
+	// Default: 0 (= disabled)
+	FailureThreshold int
+
+	// BreakerCooldown is the time the circuit stays open.
+	// Default: 1s
+	BreakerCooldown time.Duration
+
+	// TestOnBorrow is an optional function, called on idle connections
+	// before they are handed out by Get, with the time they were last returned
+	// to the pool. If the function returns an error, the connection is closed
+	// and discarded. Fresh connections created by the factory are not tested.
+	TestOnBorrow func(cn T, lastAccess time.Time) error
+
+	// KeepDeadlines disables the clearing of deadlines. By default,
+	// deadlines of connections returned via Put are cleared, so they
+	// are not inherited by the next borrower.
+	// Default: false
+	KeepDeadlines bool
+
+	// OnReturn is an optional function, called on connections returned
+	// via Put before they re-enter the pool, e.g. to reset their state. If
+	// the function returns an error, the connection is closed instead. It is
+	// not called on connections that are discarded anyway, because the pool
+	// is full or closed. Connections implementing Reset() error are reset
+	// before OnReturn is called.
+	OnReturn func(cn T) error
+
+	// IsBadConn is an optional function that decides whether an error passed
+	// to PutErr, or returned by the callback of With, means that the
+	// connection is broken and must be closed. On other errors, e.g.
+	// protocol-level failures, the connection is returned to the pool.
+	// Default: true for net.Error, io.EOF, io.ErrClosedPipe and net.ErrClosed
+	IsBadConn func(err error) bool
+
+	// OnGet is an optional function, called whenever a connection is handed
+	// out by Get, GetContext or TryGet. The hit flag reports whether the
+	// connection came from the pool or was freshly dialed.
+	OnGet func(cn T, hit bool)
+
+	// OnClose is an optional function, called whenever the pool closes
+	// an item, with the result of the Close call.
+	OnClose func(cn T, err error)
+
+	// Logger is an optional logger for background events, such as reaped
+	// connections, failed MinIdle refills and health check evictions.
+	// Default: nil (= no logging)
+	Logger Logger
+
+	// IdleHistogram enables Stats.IdleHistogram, which records how long
+	// connections sat idle before Get handed them out again. It costs a
+	// clock read on every Get.
+	// Default: false
+	IdleHistogram bool
+
+	// LeakDetect enables detection of connections obtained via GetWrapped
+	// that are garbage collected without being released. Leaks are logged,
+	// together with the stack of the GetWrapped call, and the connection is
+	// closed. Intended for debugging, as it captures a stack trace on each
+	// GetWrapped.
+	// Default: false
+	LeakDetect bool
+
+	// HealthCheck is an optional function, called periodically on idle
+	// connections in the background. Connections that fail the check are
+	// closed and removed from the pool.
+	HealthCheck func(cn T) error
+
+	// HealthCheckInterval determines the frequency of health checks.
+	// Default: ReapInterval
+	HealthCheckInterval time.Duration
+
+	// FIFO makes Get hand out the least recently returned idle connection
+	// instead of the most recent one. This spreads usage evenly across all
+	// idle connections, at the cost of keeping fewer of them warm.
+	// Default: false (= LIFO)
+	FIFO bool
+
+	// Shards is the number of independent idle lists. Higher values reduce
+	// lock contention under heavy parallel load, at the cost of strict LIFO
+	// ordering, e.g. use runtime.GOMAXPROCS(0).
+	// Default: 1
+	Shards int
+
+	// ProbeOnReap enables detection of idle connections closed by the peer.
+	// On every reap cycle, a non-blocking one byte read is attempted on each
+	// idle connection that supports read deadlines; connections that report
+	// EOF, an error or unexpected data are closed.
+	// Default: false
+	ProbeOnReap bool
+
+	// ReapInterval determines the frequency of reap cycles. No background
+	// goroutine is started unless IdleTimeout, MaxLifetime, MinIdle,
+	// HealthCheck, ProbeOnReap or AutoScale are set.
 	// Default: 1 minute
 	ReapInterval time.Duration
+
+	// now returns the current time, tests may replace it
+	now func() time.Time
 }
 
-func (o *Options) norm() Options {
+func (o *OptionsOf[T]) norm() OptionsOf[T] {
 	x := *o
 	if x.ReapInterval <= 0 {
 		x.ReapInterval = time.Minute
@@ -41,163 +373,1513 @@ func (o *Options) norm() Options {
 	if x.MaxCap <= 0 {
 		x.MaxCap = 10
 	}
+	if x.MaxActive > 0 && x.InitialSize > x.MaxActive {
+		x.InitialSize = x.MaxActive
+	}
 	if x.MaxCap < x.InitialSize {
 		x.MaxCap = x.InitialSize
 	}
+	if x.MaxActive > 0 && x.MaxCap > x.MaxActive {
+		x.MaxCap = x.MaxActive
+	}
+	if x.Shards <= 0 {
+		x.Shards = 1
+	}
+	if x.BreakerCooldown <= 0 {
+		x.BreakerCooldown = time.Second
+	}
+	if x.RetryBackoff <= 0 {
+		x.RetryBackoff = 10 * time.Millisecond
+	}
+	if x.HealthCheckInterval <= 0 {
+		x.HealthCheckInterval = x.ReapInterval
+	}
+	if x.AutoScaleWindow <= 0 {
+		x.AutoScaleWindow = x.ReapInterval
+	}
+	if x.AutoScaleHigh <= 0 {
+		x.AutoScaleHigh = 0.1
+	}
+	if x.AutoScaleLow <= 0 {
+		x.AutoScaleLow = 0.01
+	}
+	if x.MinIdle > x.MaxCap {
+		x.MinIdle = x.MaxCap
+	}
+	if x.now == nil {
+		x.now = time.Now
+	}
+	if x.IsBadConn == nil {
+		x.IsBadConn = isBadConn
+	}
 	return x
 }
 
+// isBadConn is the default Options.IsBadConn.
+func isBadConn(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed)
+}
+
 type none struct{}
 
-// Pool contains a number of connections
-type Pool struct {
-	conns   []member
-	opt     Options
-	factory Factory
+type deadliner interface {
+	SetDeadline(time.Time) error
+}
+
+// resetter is implemented by connections that can return to a clean state
+// cheaply, Reset is called when they are returned to the pool.
+type resetter interface {
+	Reset() error
+}
+
+// Of is a generic pool of io.Closer items, such as connections
+type Of[T io.Closer] struct {
+	shards  []stack[T]
+	hint    uint32
+	opt     OptionsOf[T]
+	factory atomic.Value // FactoryInfoOf[T]
+
+	// out tracks the metadata of checked-out connections, only
+	// maintained when MaxLifetime, MaxUses or FactoryInfo are set
+	out map[io.Closer]member[T]
+
+	// owned holds all live connections, only maintained with StrictOwnership
+	owned map[io.Closer]none
+
+	// scaler holds the AutoScale state, only used by loop
+	scaler scaler
+
+	// breaker is only set when FailureThreshold is configured
+	breaker *breaker
+
+	// sem holds a token for each live connection, only set when MaxActive
+	// is configured; waiters queues blocked Get calls in arrival order, they
+	// are handed returned connections and released tokens directly
+	sem     chan none
+	waiters []chan grant[T]
+	waitMu  sync.Mutex
+
+	// drained is signalled when the last checked-out connection is
+	// returned while the pool is draining
+	drained chan none
 
 	dying, dead chan none
 
-	avail  uint32
-	closed int32
+	// reapEvery passes new reap intervals to loop
+	reapEvery chan time.Duration
+
+	// wrap and unwrap convert between pooled and borrowed connections,
+	// only set when CountBytes is enabled
+	wrap, unwrap func(T) T
+
+	// looping is set once loop has been started, the loop is only started
+	// when there is background work to do
+	looping bool
+	loopMu  sync.Mutex
+
+	// idleCh is closed when a member is added to the idle list while
+	// idleWaiters are waiting in WaitForIdle
+	idleCh      chan none
+	idleWaiters int32
+	idleMu      sync.Mutex
+
+	// events is the subscriber channel, created on the first call to Events
+	events     chan Event
+	eventsOnce sync.Once
+	subscribed int32
 
+	// size counts idle members plus reserved slots of in-flight puts, it
+	// enforces MaxCap atomically
+	size int32
+
+	maxCap     int32
+	minIdle    int32
+	closed     int32
+	draining   int32
+	prewarming int32
+	lazy       int32
+	active     int32
+	waiting    int32
+
+	hits, misses, timeouts  uint64
+	reaped                  uint64
+	idleHist                [len(idleBuckets) + 1]uint64
+	waitCount               uint64
+	waitDuration            int64
+	droppedEvents           uint64
+	maxIdleTime             int64
+	reapInterval            int64
+	bytesRead, bytesWritten uint64
+
+	// mu guards out and owned
 	mu sync.Mutex
+
+	// reapMu serializes reap cycles with each other and the final close
+	reapMu sync.Mutex
+
+	// batch serializes GetN, it holds a token while a batch is in progress
+	batch chan none
 }
 
-// New creates a pool with an initial number of connection and a maximum cap
-func New(opt *Options, factory Factory) (*Pool, error) {
+// NewOf creates a generic pool with an initial number of items and a maximum cap
+func NewOf[T io.Closer](opt *OptionsOf[T], factory FactoryOf[T]) (*Of[T], error) {
+	return NewOfContext(context.Background(), opt, factory)
+}
+
+// NewOfContext creates a generic pool like NewOf, dialing the initial items
+// under the context.
+func NewOfContext[T io.Closer](ctx context.Context, opt *OptionsOf[T], factory FactoryOf[T]) (*Of[T], error) {
 	if opt == nil {
-		opt = new(Options)
+		opt = new(OptionsOf[T])
 	}
 
-	p := &Pool{
-		conns:   make([]member, 0, opt.MaxCap),
-		factory: factory,
-		opt:     opt.norm(),
-		dying:   make(chan none),
-		dead:    make(chan none),
+	p := &Of[T]{
+		opt:       opt.norm(),
+		dying:     make(chan none),
+		reapEvery: make(chan time.Duration),
+		dead:      make(chan none),
+		drained:   make(chan none, 1),
+		batch:     make(chan none, 1),
 	}
-
-	for i := 0; i < opt.InitialSize; i++ {
-		cn, err := factory()
-		if err != nil {
-			_ = p.close()
-			return nil, err
+	p.shards = make([]stack[T], p.opt.Shards)
+	switch {
+	case opt.FactoryInfo != nil:
+		p.factory.Store(opt.FactoryInfo)
+	case opt.FactoryContext != nil:
+		p.SetFactoryContext(opt.FactoryContext)
+	default:
+		p.SetFactory(factory)
+	}
+	p.maxCap = int32(p.opt.MaxCap)
+	p.minIdle = int32(p.opt.MinIdle)
+	p.scaler.sampled = time.Now()
+	p.maxIdleTime = int64(p.opt.IdleTimeout)
+	p.reapInterval = int64(p.opt.ReapInterval)
+	if p.opt.MaxLifetime > 0 || p.opt.MaxUses > 0 || p.opt.FactoryInfo != nil {
+		p.out = make(map[io.Closer]member[T])
+	}
+	if p.opt.StrictOwnership {
+		p.owned = make(map[io.Closer]none)
+	}
+	if p.opt.FailureThreshold > 0 {
+		p.breaker = &breaker{
+			threshold: int32(p.opt.FailureThreshold),
+			cooldown:  p.opt.BreakerCooldown,
 		}
-		p.Put(cn)
+	}
+	if p.opt.MaxActive > 0 {
+		p.sem = make(chan none, p.opt.MaxActive)
 	}
 
-	go p.loop()
+	if p.opt.LazyInit {
+		p.lazy = 1
+	} else if err := p.warmup(ctx, p.opt.InitialSize); err != nil {
+		_ = p.close()
+		return nil, err
+	}
+
+	if p.needsLoop() {
+		p.startLoop()
+	}
 	return p, nil
 }
 
+// needsLoop returns true if the configuration requires background work.
+func (s *Of[T]) needsLoop() bool {
+	o := &s.opt
+	return o.IdleTimeout > 0 || o.MaxLifetime > 0 || o.MinIdle > 0 ||
+		o.HealthCheck != nil || o.ProbeOnReap || o.AutoScale
+}
+
+// startLoop starts the background loop, unless it is already running or the
+// pool is closed.
+func (s *Of[T]) startLoop() {
+	s.loopMu.Lock()
+	if !s.looping && atomic.LoadInt32(&s.closed) == 0 {
+		s.looping = true
+		go s.loop()
+	}
+	s.loopMu.Unlock()
+}
+
 // Len returns the number of available connections in the pool
-func (s *Pool) Len() int { return int(atomic.LoadUint32(&s.avail)) }
+func (s *Of[T]) Len() int {
+	n := s.idleLen()
 
-// Get returns a connection from the pool or creates a new one
-func (s *Pool) Get() (net.Conn, error) {
-	if cn := s.pop(); cn != nil {
-		return cn, nil
+	// shards are read one by one, a connection moving between them can be
+	// counted twice, but never more than the reserved slots
+	if size := int(atomic.LoadInt32(&s.size)); n > size {
+		n = size
 	}
+	return n
+}
 
-	return s.factory()
+// idleLen sums the per-shard counters.
+func (s *Of[T]) idleLen() int {
+	n := 0
+	for i := range s.shards {
+		n += s.shards[i].Len()
+	}
+	return n
 }
 
-// Put adds/returns a connection to the pool
-func (s *Pool) Put(cn net.Conn) bool {
-	if s.Len() >= s.opt.MaxCap || atomic.LoadInt32(&s.closed) == 1 {
-		_ = cn.Close()
-		return false
+// LenShard returns the number of available connections in shard i, or 0 if
+// there is no such shard.
+func (s *Of[T]) LenShard(i int) int {
+	if i < 0 || i >= len(s.shards) {
+		return 0
+	}
+	return s.shards[i].Len()
+}
+
+// Active returns the number of connections currently checked out, i.e.
+// handed out by Get and not yet returned. Connections closed by the caller
+// instead of being returned via Put or PutErr are counted forever.
+func (s *Of[T]) Active() int { return int(atomic.LoadInt32(&s.active)) }
+
+// MaxCap returns the maximum number of idle connections retained.
+func (s *Of[T]) MaxCap() int { return int(atomic.LoadInt32(&s.maxCap)) }
+
+// SetFactory replaces the factory used for future dials. Idle connections
+// created by the previous factory are kept, call Flush to replace them too.
+func (s *Of[T]) SetFactory(factory FactoryOf[T]) {
+	s.SetFactoryContext(func(context.Context) (T, error) { return factory() })
+}
+
+// SetFactoryContext is like SetFactory, for context-aware factories.
+func (s *Of[T]) SetFactoryContext(factory FactoryContextOf[T]) {
+	s.factory.Store(FactoryInfoOf[T](func(ctx context.Context) (T, ConnInfo, error) {
+		cn, err := factory(ctx)
+		return cn, nil, err
+	}))
+}
+
+// Info returns the metadata attached to a checked-out connection by
+// FactoryInfo.
+func (s *Of[T]) Info(cn T) (ConnInfo, bool) {
+	if s.out == nil {
+		return nil, false
+	}
+	if s.unwrap != nil {
+		cn = s.unwrap(cn)
 	}
 
-	m := member{cn: cn, lastAccess: time.Now()}
 	s.mu.Lock()
-	s.conns = append(s.conns, m)
-	atomic.StoreUint32(&s.avail, uint32(len(s.conns)))
+	m, ok := s.out[cn]
 	s.mu.Unlock()
 
-	return true
+	if !ok || m.info == nil {
+		return nil, false
+	}
+	return m.info, true
+}
+
+// String summarizes the pool state for debugging.
+func (s *Of[T]) String() string {
+	return fmt.Sprintf("pool{idle=%d active=%d maxcap=%d closed=%t}",
+		s.Len(), s.Active(), s.MaxCap(), atomic.LoadInt32(&s.closed) == 1)
+}
+
+// Options returns the normalized options in effect, including any changes
+// made by SetMaxCap, SetConnMaxIdleTime and SetReapInterval.
+func (s *Of[T]) Options() OptionsOf[T] {
+	opt := s.opt
+	opt.MaxCap = s.MaxCap()
+	opt.IdleTimeout = s.idleTimeout()
+	opt.ReapInterval = time.Duration(atomic.LoadInt64(&s.reapInterval))
+	return opt
+}
+
+// SetMaxCap updates the maximum number of idle connections retained.
+// Excess idle connections are closed immediately, oldest first. Values below 1
+// are adjusted to 1.
+func (s *Of[T]) SetMaxCap(n int) {
+	if n < 1 {
+		n = 1
+	}
+	atomic.StoreInt32(&s.maxCap, int32(n))
+
+	excess := s.idleLen() - n
+	if excess <= 0 {
+		return
+	}
+
+	// shards are only ordered individually, pick the oldest across all
+	var times []time.Time
+	for i := range s.shards {
+		s.shards[i].scan(func(m member[T]) { times = append(times, m.lastAccess) })
+	}
+	cutoff := nthOldest(times, excess)
+
+	for i := range s.shards {
+		removed := s.shards[i].filter(func(m member[T]) bool {
+			if excess > 0 && !m.lastAccess.After(cutoff) {
+				excess--
+				return true
+			}
+			return false
+		})
+		atomic.AddInt32(&s.size, -int32(len(removed)))
+		for _, cn := range removed {
+			_ = s.discard(cn)
+		}
+	}
+}
+
+// SetConnMaxIdleTime updates the IdleTimeout, it takes effect on the next
+// reap cycle. Values <= 0 disable reaping of idle connections.
+func (s *Of[T]) SetConnMaxIdleTime(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.StoreInt64(&s.maxIdleTime, int64(d))
+	if d > 0 {
+		s.startLoop()
+	}
+}
+
+// SetReapInterval updates the ReapInterval, the next reap cycle is scheduled
+// after d. Values <= 0 are ignored.
+func (s *Of[T]) SetReapInterval(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	atomic.StoreInt64(&s.reapInterval, int64(d))
+	s.startLoop()
+	select {
+	case s.reapEvery <- d:
+	case <-s.dying:
+	}
+}
+
+// Get returns a connection from the pool or creates a new one. When
+// MaxActive is reached, Get blocks until a connection becomes available,
+// unless NoWait is set, or for at most WaitTimeout. Get returns
+// ErrPoolClosed once the pool is closed, the check happens before idle
+// connections are considered, since Close discards those anyway. Blocked
+// callers are woken up by Close.
+//
+// Every connection obtained from the pool must be handed back via Put or
+// PutErr, broken ones included. Closing a connection directly leaks the
+// state the pool keeps for it, such as its MaxActive token, its Active
+// count, which Drain waits for, and its MaxLifetime, MaxUses, FactoryInfo
+// and StrictOwnership records.
+func (s *Of[T]) Get() (T, error) {
+	return s.GetFunc(nil)
+}
+
+// GetFunc is like Get, but only hands out idle connections for which match
+// returns true, e.g. connections already authenticated as a particular
+// user. If there is none, a new connection is created; when MaxActive is
+// reached, a non-matching idle connection is closed to make room. A nil
+// match accepts any connection.
+func (s *Of[T]) GetFunc(match func(T) bool) (T, error) {
+	return s.borrow(context.Background(), match, s.opt.WaitTimeout)
+}
+
+// GetContext returns a connection from the pool or creates a new one.
+// It aborts with the context's error if the context is cancelled while waiting
+// for a connection to become available. The context is passed on to
+// FactoryContext, if configured. Like with Get, the connection must be
+// handed back via Put or PutErr rather than closed directly.
+func (s *Of[T]) GetContext(ctx context.Context) (T, error) {
+	return s.borrow(ctx, nil, 0)
+}
+
+// borrow hands out a connection, recording stats and calling hooks.
+func (s *Of[T]) borrow(ctx context.Context, match func(T) bool, timeout time.Duration) (T, error) {
+	cn, hit, wait, err := s.get(ctx, match, timeout)
+	if err == nil {
+		if s.wrap != nil {
+			cn = s.wrap(cn)
+		}
+		s.emit(EventBorrowed)
+		if s.opt.OnGet != nil {
+			s.opt.OnGet(cn, hit)
+		}
+		if atomic.LoadInt32(&s.lazy) == 1 && atomic.CompareAndSwapInt32(&s.lazy, 1, 0) {
+			go s.lazyFill()
+		}
+	}
+	if wait > 0 {
+		atomic.AddUint64(&s.waitCount, 1)
+		atomic.AddInt64(&s.waitDuration, int64(wait))
+	}
+	if trace := ContextGetTrace(ctx); trace != nil && trace.GetDone != nil {
+		trace.GetDone(hit, wait, err)
+	}
+	return cn, err
+}
+
+// GetN returns n connections at once. Concurrent GetN calls are serialized,
+// so two batches can't deadlock each other under MaxActive by holding parts
+// of their batch while waiting for the rest. On error, all connections
+// obtained so far are returned to the pool. Requests for more than
+// MaxActive connections fail with ErrPoolExhausted. The context also bounds
+// the time spent waiting for other batches.
+func (s *Of[T]) GetN(ctx context.Context, n int) ([]T, error) {
+	if n <= 0 {
+		return nil, errors.New("pool: batch size must be positive")
+	}
+	if s.opt.MaxActive > 0 && n > s.opt.MaxActive {
+		return nil, ErrPoolExhausted
+	}
+
+	select {
+	case s.batch <- none{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.dying:
+		return nil, ErrPoolClosed
+	}
+	defer func() { <-s.batch }()
+
+	conns := make([]T, 0, n)
+	for i := 0; i < n; i++ {
+		cn, err := s.GetContext(ctx)
+		if err != nil {
+			for _, cn := range conns {
+				s.Put(cn)
+			}
+			return nil, err
+		}
+		conns = append(conns, cn)
+	}
+	return conns, nil
+}
+
+// get implements GetContext and GetFunc. It reports whether the connection was served
+// from the pool and the time spent waiting for MaxActive. A positive timeout
+// limits the total wait, but not the dial.
+func (s *Of[T]) get(ctx context.Context, match func(T) bool, timeout time.Duration) (cn T, hit bool, wait time.Duration, err error) {
+	for {
+		if atomic.LoadInt32(&s.closed) == 1 {
+			return cn, false, wait, ErrPoolClosed
+		}
+		if atomic.LoadInt32(&s.draining) == 1 {
+			return cn, false, wait, ErrPoolDraining
+		}
+
+		if cn, ok := s.next(match); ok {
+			atomic.AddUint64(&s.hits, 1)
+			atomic.AddInt32(&s.active, 1)
+			return cn, true, wait, nil
+		}
+
+		if s.sem == nil {
+			cn, err = s.dial(ctx)
+			return cn, false, wait, err
+		}
+
+		// try without blocking first
+		select {
+		case s.sem <- none{}:
+			cn, err = s.dial(ctx)
+			return cn, false, wait, err
+		default:
+		}
+
+		// none of the idle connections match, make room for a new one
+		if match != nil {
+			if cn, ok := s.evict(); ok {
+				_ = s.discard(cn)
+				continue
+			}
+		}
+
+		if s.opt.NoWait {
+			return cn, false, wait, ErrPoolExhausted
+		}
+
+		start := time.Now()
+		g, retry, err := s.waitTimeout(ctx, timeout, wait)
+		wait += time.Since(start)
+		switch {
+		case err == ErrPoolClosed, err == ErrTooManyWaiters:
+			return cn, false, wait, err
+		case err != nil:
+			atomic.AddUint64(&s.timeouts, 1)
+			return cn, false, wait, err
+		case retry:
+			continue
+		case !g.conn:
+			cn, err = s.dial(ctx)
+			return cn, false, wait, err
+		case match != nil && !match(g.m.cn):
+			_ = s.discard(g.m.cn)
+		case s.checkout(g.m):
+			atomic.AddUint64(&s.hits, 1)
+			atomic.AddInt32(&s.active, 1)
+			return g.m.cn, true, wait, nil
+		}
+	}
+}
+
+// TryGet returns an idle connection from the pool, if available. It never
+// creates new connections and never blocks.
+func (s *Of[T]) TryGet() (T, bool) {
+	if atomic.LoadInt32(&s.draining) == 1 {
+		var zero T
+		return zero, false
+	}
+
+	cn, ok := s.next(nil)
+	if ok {
+		if s.wrap != nil {
+			cn = s.wrap(cn)
+		}
+		atomic.AddUint64(&s.hits, 1)
+		atomic.AddInt32(&s.active, 1)
+		s.emit(EventBorrowed)
+		if s.opt.OnGet != nil {
+			s.opt.OnGet(cn, true)
+		}
+	}
+	return cn, ok
+}
+
+// PutOutcome describes what happened to a connection returned via PutResult.
+type PutOutcome int
+
+const (
+	// Pooled means the connection was added to the idle list or handed to
+	// a waiting Get.
+	Pooled PutOutcome = iota
+	// DiscardedFull means the connection was closed because the pool had
+	// already reached MaxCap.
+	DiscardedFull
+	// DiscardedClosed means the connection was closed because the pool is
+	// closed or draining.
+	DiscardedClosed
+	// DiscardedInvalid means the connection was closed because it was
+	// broken, expired, foreign or rejected by OnReturn.
+	DiscardedInvalid
+)
+
+// String implements fmt.Stringer.
+func (o PutOutcome) String() string {
+	switch o {
+	case Pooled:
+		return "pooled"
+	case DiscardedFull:
+		return "discarded-full"
+	case DiscardedClosed:
+		return "discarded-closed"
+	case DiscardedInvalid:
+		return "discarded-invalid"
+	}
+	return "unknown"
+}
+
+// Put adds/returns a connection to the pool. It returns false if the
+// connection was closed instead, e.g. because the pool is closed or full.
+// Putting a nil connection is a no-op. Only connections obtained from the
+// pool should be put, others are pooled without holding a MaxActive slot,
+// unless StrictOwnership is set.
+func (s *Of[T]) Put(cn T) bool {
+	return s.PutErr(cn, nil)
+}
+
+// PutErr returns a connection to the pool like Put, unless err is reported
+// by Options.IsBadConn. In that case the connection is considered broken and
+// closed instead, and PutErr returns false. Pass the error of the last
+// operation on the connection, to avoid handing broken connections to the
+// next caller.
+func (s *Of[T]) PutErr(cn T, err error) bool {
+	return s.putErr(cn, err != nil && s.opt.IsBadConn(err)) == Pooled
+}
+
+// PutResult returns a connection to the pool like Put, but reports why the
+// connection was closed instead, e.g. to tell a saturated pool from one that
+// is shutting down. Putting a nil connection is a no-op and reports
+// DiscardedInvalid.
+func (s *Of[T]) PutResult(cn T) PutOutcome {
+	return s.putErr(cn, false)
+}
+
+// With borrows a connection via GetContext, calls fn with it and returns it
+// to the pool via PutErr with the error of fn, i.e. the connection is closed
+// if Options.IsBadConn reports the error. The connection is also closed if
+// fn panics, before the panic is propagated. It returns the error of
+// GetContext or fn.
+func (s *Of[T]) With(ctx context.Context, fn func(T) error) error {
+	cn, err := s.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	done := false
+	defer func() {
+		if !done {
+			_ = s.putErr(cn, true)
+		}
+	}()
+
+	err = fn(cn)
+	done = true
+	_ = s.PutErr(cn, err)
+	return err
+}
+
+// putErr implements PutErr and PutResult. The connection is closed if bad
+// is set.
+func (s *Of[T]) putErr(cn T, bad bool) PutOutcome {
+	if isNil(cn) {
+		return DiscardedInvalid
+	}
+	if s.unwrap != nil {
+		cn = s.unwrap(cn)
+	}
+	if !s.owns(cn) {
+		_ = s.closeConn(cn)
+		return DiscardedInvalid
+	}
+
+	s.emit(EventReturned)
+	if bad {
+		_ = s.drop(cn)
+		return DiscardedInvalid
+	}
+
+	res := s.put(cn, true)
+	s.checkin()
+	return res
+}
+
+// put adds a connection to the idle list. OnReturn is only applied to
+// returned connections, not to fresh ones.
+func (s *Of[T]) put(cn T, returned bool) PutOutcome {
+	now := s.opt.now()
+	m := s.untrack(cn, now)
+	m.lastAccess = now
+
+	if atomic.LoadInt32(&s.closed) == 1 || atomic.LoadInt32(&s.draining) == 1 {
+		_ = s.discard(cn)
+		return DiscardedClosed
+	}
+	if s.expired(m, now) {
+		_ = s.discard(cn)
+		return DiscardedInvalid
+	}
+	if !s.reserve() {
+		_ = s.discard(cn)
+		return DiscardedFull
+	}
+
+	if returned && !s.opt.KeepDeadlines {
+		if d, ok := any(cn).(deadliner); ok && d.SetDeadline(time.Time{}) != nil {
+			atomic.AddInt32(&s.size, -1)
+			_ = s.discard(cn)
+			return DiscardedInvalid
+		}
+	}
+
+	if r, ok := any(cn).(resetter); returned && ok && r.Reset() != nil {
+		atomic.AddInt32(&s.size, -1)
+		_ = s.discard(cn)
+		return DiscardedInvalid
+	}
+
+	if fn := s.opt.OnReturn; returned && fn != nil && fn(cn) != nil {
+		atomic.AddInt32(&s.size, -1)
+		_ = s.discard(cn)
+		return DiscardedInvalid
+	}
+
+	if s.stash(m, false) {
+		return Pooled
+	}
+
+	// the pool was closed concurrently, close may have missed the push
+	if atomic.LoadInt32(&s.closed) == 1 || atomic.LoadInt32(&s.draining) == 1 {
+		_ = s.close()
+		return DiscardedClosed
+	}
+	s.notifyIdle()
+	return Pooled
 }
 
-// Close closes all connections and the pool
-func (s *Pool) Close() error {
+// Close closes all connections and the pool. It returns all errors
+// encountered while closing the idle connections, joined. Close waits for
+// the background loop to return, including any reap cycle in progress,
+// before it closes the remaining idle connections.
+func (s *Of[T]) Close() error {
 	if !atomic.CompareAndSwapInt32(&s.closed, 0, 1) {
 		return nil
 	}
 
 	close(s.dying)
-	<-s.dead
+
+	s.loopMu.Lock()
+	looping := s.looping
+	s.loopMu.Unlock()
+	if looping {
+		<-s.dead
+	}
+
+	s.reapMu.Lock()
+	defer s.reapMu.Unlock()
 	return s.close()
 }
 
-func (s *Pool) pop() net.Conn {
-	s.mu.Lock()
+// Flush closes all idle connections, without closing the pool. Subsequent
+// calls to Get create new connections, checked-out connections are not
+// affected. It returns all errors encountered while closing, joined.
+func (s *Of[T]) Flush() error {
+	return s.close()
+}
 
-	pos := len(s.conns) - 1
-	if pos < 0 {
-		s.mu.Unlock()
+// FillTo dials connections concurrently until the pool holds n idle
+// connections, but no more than MaxCap. It returns the first error
+// encountered. If the context is cancelled, FillTo returns immediately and
+// keeps the connections created so far.
+func (s *Of[T]) FillTo(ctx context.Context, n int) error {
+	if atomic.LoadInt32(&s.closed) == 1 {
+		return ErrPoolClosed
+	}
+	if max := s.MaxCap(); n > max {
+		n = max
+	}
+	if n -= s.Len(); n <= 0 {
 		return nil
 	}
+	return s.warmup(ctx, n)
+}
 
-	m := s.conns[pos]
-	s.conns = s.conns[:pos]
-	atomic.StoreUint32(&s.avail, uint32(len(s.conns)))
-	s.mu.Unlock()
+// WaitForIdle blocks until the pool holds at least n idle connections, or
+// until the context is done. This is useful to wait for MinIdle to be
+// reached after startup.
+func (s *Of[T]) WaitForIdle(ctx context.Context, n int) error {
+	atomic.AddInt32(&s.idleWaiters, 1)
+	defer atomic.AddInt32(&s.idleWaiters, -1)
+
+	for {
+		s.idleMu.Lock()
+		if s.idleCh == nil {
+			s.idleCh = make(chan none)
+		}
+		ch := s.idleCh
+		s.idleMu.Unlock()
 
-	return m.cn
+		// check after registering, so no notification is missed
+		if s.Len() >= n {
+			return nil
+		}
 
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 }
 
-func (s *Pool) close() (err error) {
+// notifyIdle wakes up WaitForIdle callers.
+func (s *Of[T]) notifyIdle() {
+	if atomic.LoadInt32(&s.idleWaiters) == 0 {
+		return
+	}
+
+	s.idleMu.Lock()
+	if s.idleCh != nil {
+		close(s.idleCh)
+		s.idleCh = nil
+	}
+	s.idleMu.Unlock()
+}
+
+// Drain stops the pool from handing out connections, closes all idle
+// connections and blocks until all checked-out connections have been
+// returned or until the context is done. Subsequent calls to Get return
+// ErrPoolDraining, returned connections are closed.
+func (s *Of[T]) Drain(ctx context.Context) error {
+	atomic.StoreInt32(&s.draining, 1)
+	err := s.close()
+
+	for atomic.LoadInt32(&s.active) > 0 {
+		select {
+		case <-s.drained:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// CloseContext is like Close, but first drains the pool, blocking until all
+// checked-out connections have been returned or until the context is done.
+// The pool is closed in either case.
+func (s *Of[T]) CloseContext(ctx context.Context) error {
+	err := s.Drain(ctx)
+	return errors.Join(err, s.Close())
+}
+
+// drop closes a checked-out connection instead of returning it to the pool.
+func (s *Of[T]) drop(cn T) error {
+	if s.unwrap != nil {
+		cn = s.unwrap(cn)
+	}
+	s.untrack(cn, time.Time{})
+	err := s.discard(cn)
+	s.checkin()
+	return err
+}
+
+// checkin decrements the number of checked-out connections.
+func (s *Of[T]) checkin() {
 	for {
-		cn := s.pop()
-		if cn == nil {
+		n := atomic.LoadInt32(&s.active)
+		if n <= 0 || atomic.CompareAndSwapInt32(&s.active, n, n-1) {
 			break
 		}
-		if e := cn.Close(); e != nil {
-			err = e
+	}
+
+	if atomic.LoadInt32(&s.draining) == 1 && atomic.LoadInt32(&s.active) == 0 {
+		select {
+		case s.drained <- none{}:
+		default:
 		}
 	}
+}
+
+// next pops the next usable idle connection, discarding expired and
+// invalid ones.
+func (s *Of[T]) next(match func(T) bool) (T, bool) {
+	var zero T
+	for {
+		m, ok := s.take(match)
+		if !ok {
+			return zero, false
+		}
+		if s.checkout(m) {
+			if s.opt.PrewarmOnDrain && s.Len() == 0 {
+				s.prewarm()
+			}
+			return m.cn, true
+		}
+	}
+}
+
+// prewarm dials a single connection in the background, unless one is
+// already being dialed.
+func (s *Of[T]) prewarm() {
+	if !atomic.CompareAndSwapInt32(&s.prewarming, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&s.prewarming, 0)
+		s.refill()
+	}()
+}
+
+// lazyFill dials the InitialSize connections deferred by LazyInit, counting
+// those already in use.
+func (s *Of[T]) lazyFill() {
+	for s.Len()+s.Active() < s.opt.InitialSize {
+		if !s.refill() {
+			return
+		}
+	}
+}
+
+// checkout prepares a member for use. It returns false if the member is
+// no longer usable and was discarded instead.
+func (s *Of[T]) checkout(m member[T]) bool {
+	// only read the clock if needed, it dominates the cost of a hit
+	var now time.Time
+	if s.opt.MaxLifetime > 0 || s.opt.IdleHistogram {
+		now = s.opt.now()
+	}
+	if s.expired(m, now) {
+		_ = s.discard(m.cn)
+		return false
+	}
+	if s.opt.MaxUses > 0 && m.uses >= s.opt.MaxUses {
+		_ = s.discard(m.cn)
+		return false
+	}
+	if test := s.opt.TestOnBorrow; test != nil && test(m.cn, m.lastAccess) != nil {
+		_ = s.discard(m.cn)
+		return false
+	}
+	if s.opt.IdleHistogram {
+		s.observeIdle(now.Sub(m.lastAccess))
+	}
+	m.uses++
+	s.track(m)
+	return true
+}
+
+// dial creates a new connection using the factory. If the context is
+// done by the time the factory returns, the connection is pooled instead.
+// The MaxActive token must be held by the caller and is released on error.
+func (s *Of[T]) dial(ctx context.Context) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		atomic.AddUint64(&s.timeouts, 1)
+		s.release()
+		return zero, err
+	}
+	if atomic.LoadInt32(&s.closed) == 1 {
+		s.release()
+		return zero, ErrPoolClosed
+	}
+	if atomic.LoadInt32(&s.draining) == 1 {
+		s.release()
+		return zero, ErrPoolDraining
+	}
+
+	if s.breaker != nil && !s.breaker.Allow() {
+		s.release()
+		return zero, ErrCircuitOpen
+	}
+
+	atomic.AddUint64(&s.misses, 1)
+	cn, err := s.createRetry(ctx)
+	if s.breaker != nil {
+		s.breaker.Record(err)
+	}
+	if err != nil {
+		s.release()
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return zero, err
+		}
+		return zero, fmt.Errorf("pool: dial failed: %w", err)
+	}
+
+	// the pool was closed while dialing, don't leak the connection
+	if atomic.LoadInt32(&s.closed) == 1 {
+		_ = s.discard(cn)
+		return zero, ErrPoolClosed
+	}
+
+	if err := ctx.Err(); err != nil {
+		atomic.AddUint64(&s.timeouts, 1)
+		s.put(cn, false)
+		return zero, err
+	}
+
+	m := s.untrack(cn, s.opt.now())
+	m.uses = 1
+	s.track(m)
+	atomic.AddInt32(&s.active, 1)
+	return cn, nil
+}
+
+// createRetry calls create, retrying failed attempts with exponential
+// backoff according to MaxRetries and RetryBackoff.
+func (s *Of[T]) createRetry(ctx context.Context) (T, error) {
+	backoff := s.opt.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		cn, err := s.create(ctx)
+		if err == nil || attempt >= s.opt.MaxRetries || ctx.Err() != nil ||
+			errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return cn, err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return cn, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// create calls the factory, recovering from panics.
+func (s *Of[T]) create(ctx context.Context) (cn T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrFactoryPanic, r)
+		}
+	}()
+
+	cn, info, err := s.factory.Load().(FactoryInfoOf[T])(ctx)
+	if err == nil && isNil(cn) {
+		err = ErrNilConn
+	}
+	if err == nil {
+		if s.owned != nil {
+			s.mu.Lock()
+			s.owned[cn] = none{}
+			s.mu.Unlock()
+		}
+		if info != nil {
+			s.track(member[T]{cn: cn, createdAt: s.opt.now(), info: info})
+		}
+		s.emit(EventCreated)
+	}
+	return cn, err
+}
+
+// isNil returns true if cn is a nil interface or a nil pointer.
+func isNil(cn io.Closer) bool {
+	if cn == nil {
+		return true
+	}
+
+	switch v := reflect.ValueOf(cn); v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Func, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+// discard closes a connection and releases its MaxActive token.
+func (s *Of[T]) discard(cn T) error {
+	s.untrack(cn, time.Time{})
+	if s.owned != nil {
+		s.mu.Lock()
+		delete(s.owned, cn)
+		s.mu.Unlock()
+	}
+	err := s.closeConn(cn)
+	s.release()
+	s.emit(EventClosed)
+	if s.opt.OnClose != nil {
+		s.opt.OnClose(cn, err)
+	}
 	return err
 }
 
-func (s *Pool) reap() {
-	timeout := s.opt.IdleTimeout
+// closeConn closes a connection, giving up after CloseTimeout.
+func (s *Of[T]) closeConn(cn T) error {
+	timeout := s.opt.CloseTimeout
 	if timeout <= 0 {
+		return cn.Close()
+	}
+
+	if d, ok := any(cn).(deadliner); ok {
+		_ = d.SetDeadline(time.Now().Add(timeout))
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cn.Close() }()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrCloseTimeout
+	}
+}
+
+// release returns a MaxActive token, or hands it to the longest waiting
+// Get.
+func (s *Of[T]) release() {
+	if s.sem == nil {
 		return
 	}
 
-	cutoff := time.Now().Add(-timeout)
+	s.waitMu.Lock()
+	defer s.waitMu.Unlock()
 
-	s.mu.Lock()
-	if sz := len(s.conns); sz != 0 {
-		if m := s.conns[0]; m.lastAccess.Before(cutoff) {
-			defer m.cn.Close()
+	if w, ok := s.dequeue(); ok {
+		w <- grant[T]{}
+		return
+	}
+	select {
+	case <-s.sem:
+	default:
+	}
+}
+
+// reserve reserves a slot in the idle list, it fails when MaxCap is reached.
+func (s *Of[T]) reserve() bool {
+	if atomic.AddInt32(&s.size, 1) > atomic.LoadInt32(&s.maxCap) {
+		atomic.AddInt32(&s.size, -1)
+		return false
+	}
+	return true
+}
+
+// shard picks the shard for the next operation, round-robin.
+func (s *Of[T]) shard() *stack[T] {
+	return &s.shards[s.shardIndex()]
+}
+
+func (s *Of[T]) shardIndex() int {
+	if len(s.shards) == 1 {
+		return 0
+	}
+	return int(atomic.AddUint32(&s.hint, 1) % uint32(len(s.shards)))
+}
+
+// pop pops a member, starting with the preferred shard and falling back to
+// the others.
+func (s *Of[T]) pop() (member[T], bool) {
+	start := s.shardIndex()
+	for i := range s.shards {
+		if m, ok := s.shards[(start+i)%len(s.shards)].pop(s.opt.FIFO); ok {
+			atomic.AddInt32(&s.size, -1)
+			return m, true
+		}
+	}
+	return member[T]{}, false
+}
+
+// take removes the next idle member accepted by match, or any member if
+// match is nil.
+func (s *Of[T]) take(match func(T) bool) (member[T], bool) {
+	if match == nil {
+		return s.pop()
+	}
 
-			copy(s.conns, s.conns[1:])
-			s.conns = s.conns[:sz-1]
-			atomic.StoreUint32(&s.avail, uint32(len(s.conns)))
+	start := s.shardIndex()
+	for i := range s.shards {
+		if m, ok := s.shards[(start+i)%len(s.shards)].take(match, s.opt.FIFO); ok {
+			atomic.AddInt32(&s.size, -1)
+			return m, true
 		}
 	}
+	return member[T]{}, false
+}
+
+// evict removes the oldest idle member of the first non-empty shard.
+func (s *Of[T]) evict() (T, bool) {
+	for i := range s.shards {
+		if removed := s.shards[i].shift(1); len(removed) != 0 {
+			atomic.AddInt32(&s.size, -1)
+			return removed[0], true
+		}
+	}
+
+	var zero T
+	return zero, false
+}
+
+func (s *Of[T]) close() error {
+	var errs []error
+	for {
+		m, ok := s.pop()
+		if !ok {
+			break
+		}
+		if err := s.discard(m.cn); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// expired returns true if the member has exceeded MaxLifetime.
+func (s *Of[T]) expired(m member[T], now time.Time) bool {
+	return s.opt.MaxLifetime > 0 && now.Sub(m.createdAt) >= s.opt.MaxLifetime
+}
+
+// track remembers the metadata of a checked-out connection.
+func (s *Of[T]) track(m member[T]) {
+	if s.out == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.out[m.cn] = m
 	s.mu.Unlock()
 }
 
-func (s *Pool) loop() {
+// owns returns true if cn was created by the pool, always true without
+// StrictOwnership.
+func (s *Of[T]) owns(cn T) bool {
+	if s.owned == nil {
+		return true
+	}
+
+	s.mu.Lock()
+	_, ok := s.owned[cn]
+	s.mu.Unlock()
+	return ok
+}
+
+// untrack returns the metadata of a returned connection and stops
+// tracking it. Unknown connections are assumed to be created at now.
+func (s *Of[T]) untrack(cn T, now time.Time) member[T] {
+	if s.out == nil {
+		return member[T]{cn: cn, createdAt: now}
+	}
+
+	s.mu.Lock()
+	m, ok := s.out[cn]
+	delete(s.out, cn)
+	s.mu.Unlock()
+
+	if !ok {
+		return member[T]{cn: cn, createdAt: now}
+	}
+	return m
+}
+
+// ReapNow runs a reap cycle immediately and returns the number of
+// connections closed. It is a no-op once the pool is closed.
+func (s *Of[T]) ReapNow() int {
+	s.reapMu.Lock()
+	defer s.reapMu.Unlock()
+
+	if atomic.LoadInt32(&s.closed) == 1 {
+		return 0
+	}
+	return s.reap()
+}
+
+// reap closes expired and idle connections. Must hold reapMu.
+func (s *Of[T]) reap() int {
+	if s.idleTimeout() <= 0 && s.opt.MaxLifetime <= 0 && !s.opt.ProbeOnReap {
+		return 0
+	}
+
+	now := s.opt.now()
+	reaped := 0
+	if s.opt.ProbeOnReap {
+		reaped += s.checkIdle(probe[T], func(error) { s.emit(EventReaped) })
+	}
+
+	// expired connections are always reaped, idle ones only down to
+	// MinIdle; shards are only ordered individually, so the oldest idle
+	// ones across all shards are picked first
+	expired := 0
+	var times []time.Time
+	for i := range s.shards {
+		s.shards[i].scan(func(m member[T]) {
+			if s.expired(m, now) {
+				expired++
+			} else if s.idle(m, now) {
+				times = append(times, m.lastAccess)
+			}
+		})
+	}
+	surplus := s.Len() - s.MinIdle() - expired
+	var cutoff time.Time
+	if surplus > 0 {
+		cutoff = nthOldest(times, surplus)
+	}
+
+	for i := range s.shards {
+		stale := s.shards[i].filter(func(m member[T]) bool {
+			if s.expired(m, now) {
+				return true
+			}
+			if surplus > 0 && s.idle(m, now) && !m.lastAccess.After(cutoff) {
+				surplus--
+				return true
+			}
+			return false
+		})
+		atomic.AddInt32(&s.size, -int32(len(stale)))
+		reaped += len(stale)
+
+		// close outside the lock, Get/Put must not wait for slow peers
+		for _, cn := range stale {
+			s.emit(EventReaped)
+			_ = s.discard(cn)
+		}
+	}
+
+	if reaped != 0 {
+		atomic.AddUint64(&s.reaped, uint64(reaped))
+		s.logf("pool: reaped %d connection(s)", reaped)
+	}
+	return reaped
+}
+
+// nthOldest returns the n-th oldest of times, or the newest one if there are
+// fewer. It returns the zero time if times is empty.
+func nthOldest(times []time.Time, n int) time.Time {
+	if len(times) == 0 {
+		return time.Time{}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	if n > len(times) {
+		n = len(times)
+	}
+	return times[n-1]
+}
+
+// idle returns true if the member has exceeded IdleTimeout.
+func (s *Of[T]) idle(m member[T], now time.Time) bool {
+	timeout := s.idleTimeout()
+	return timeout > 0 && now.Sub(m.lastAccess) >= timeout
+}
+
+func (s *Of[T]) idleTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.maxIdleTime))
+}
+
+// loop runs the background maintenance. Reaps and health checks run inline,
+// so dead is only closed once the last cycle has finished.
+func (s *Of[T]) loop() {
 	defer close(s.dead)
 
 	ticker := time.NewTicker(s.opt.ReapInterval)
 	defer ticker.Stop()
 
+	var healthC <-chan time.Time
+	if s.opt.HealthCheck != nil {
+		health := time.NewTicker(s.opt.HealthCheckInterval)
+		defer health.Stop()
+		healthC = health.C
+	}
+
 	for {
 		select {
 		case <-s.dying:
 			return
-		case <-ticker.C:
+		case d := <-s.reapEvery:
+			ticker.Reset(d)
+		case now := <-ticker.C:
+			if s.opt.AutoScale {
+				s.autoscale(now)
+			}
+			s.reapMu.Lock()
 			s.reap()
+			s.reapMu.Unlock()
+			s.fill()
+		case <-healthC:
+			// replace evicted connections right away to keep MinIdle
+			if s.healthCheck() != 0 {
+				s.fill()
+			}
+		}
+	}
+}
+
+// warmup dials n connections concurrently and adds them to the pool. It
+// returns the first error encountered. If the context is cancelled, it
+// returns immediately and closes connections that are still being dialed
+// once they arrive.
+func (s *Of[T]) warmup(ctx context.Context, n int) error {
+	type result struct {
+		cn  T
+		err error
+	}
+
+	results := make(chan result, n)
+	launched := 0
+dial:
+	for ; launched < n; launched++ {
+		if atomic.LoadInt32(&s.closed) == 1 {
+			break
+		}
+		if s.sem != nil {
+			select {
+			case s.sem <- none{}:
+			case <-ctx.Done():
+				break dial
+			case <-s.dying:
+				break dial
+			}
 		}
+		go func() {
+			cn, err := s.create(ctx)
+			results <- result{cn: cn, err: err}
+		}()
+	}
+
+	var err error
+	for i := 0; i < launched; i++ {
+		// prefer finished dials over cancellation
+		var res result
+		select {
+		case res = <-results:
+		default:
+			select {
+			case res = <-results:
+			case <-ctx.Done():
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if res := <-results; res.err == nil {
+							_ = s.discard(res.cn)
+						} else {
+							s.release()
+						}
+					}
+				}(launched - i)
+				return ctx.Err()
+			}
+		}
+
+		if res.err != nil {
+			s.release()
+			if err == nil {
+				err = res.err
+			}
+			continue
+		}
+		s.put(res.cn, false)
+	}
+	if err == nil && launched < n {
+		if err = ctx.Err(); err == nil {
+			err = ErrPoolClosed
+		}
+	}
+	return err
+}
+
+// fill tops up the pool to MinIdle connections. It gives up on the first
+// factory error, when MaxActive is reached or the pool is draining.
+func (s *Of[T]) fill() {
+	for s.Len() < s.MinIdle() && atomic.LoadInt32(&s.draining) == 0 {
+		if !s.refill() {
+			return
+		}
+	}
+}
+
+// refill dials a single connection and adds it to the idle list. It returns
+// false if that wasn't possible, e.g. because MaxActive is reached or the
+// pool is closed or draining.
+func (s *Of[T]) refill() bool {
+	if atomic.LoadInt32(&s.closed) == 1 || atomic.LoadInt32(&s.draining) == 1 {
+		return false
+	}
+	if s.sem != nil {
+		select {
+		case s.sem <- none{}:
+		default:
+			return false
+		}
+	}
+
+	if s.breaker != nil && !s.breaker.Allow() {
+		s.release()
+		return false
+	}
+
+	cn, err := s.create(context.Background())
+	if s.breaker != nil {
+		s.breaker.Record(err)
+	}
+	if err != nil {
+		s.release()
+		s.logf("pool: refill failed: %v", err)
+		return false
+	}
+	return s.put(cn, false) == Pooled
+}
+
+// logf logs a background event, if a Logger is configured.
+func (s *Of[T]) logf(format string, args ...any) {
+	if s.opt.Logger != nil {
+		s.opt.Logger.Printf(format, args...)
 	}
 }
 
-type member struct {
-	cn         net.Conn
+type member[T io.Closer] struct {
+	cn        T
+	createdAt time.Time
+	// lastAccess is the time the member entered the idle list via Put,
+	// IdleTimeout is measured from it
 	lastAccess time.Time
+	uses       int
+	info       ConnInfo
 }
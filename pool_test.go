@@ -1,11 +1,20 @@
 package pool_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bsm/pool"
 )
@@ -57,6 +66,3387 @@ func TestPool(t *testing.T) {
 	}
 }
 
+func TestPool_InitialSize_parallel(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	start := time.Now()
+	p, err := pool.New(&pool.Options{
+		InitialSize: 20,
+	}, func() (net.Conn, error) {
+		time.Sleep(50 * time.Millisecond)
+		return factory()
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected parallel dials, took %v", elapsed)
+	}
+	if exp, got := 20, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_InitialSize_aboveDefaultMaxCap(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	opt := &pool.Options{InitialSize: 15}
+	p, err := pool.New(opt, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if exp, got := 15, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 15, p.MaxCap(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// all of them are retained when returned
+	var conns []net.Conn
+	for i := 0; i < 15; i++ {
+		cn, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		conns = append(conns, cn)
+	}
+	for _, cn := range conns {
+		if !p.Put(cn) {
+			t.Error("expected true")
+		}
+	}
+	if exp, got := 15, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// the options passed in are not modified
+	if exp, got := 0, opt.MaxCap; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_Options(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize: 15,
+		MaxCap:      -1,
+		MaxActive:   5,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	// MaxActive is never raised, InitialSize and MaxCap are reduced instead
+	opt := p.Options()
+	if exp, got := 5, opt.InitialSize; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 5, opt.MaxCap; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 5, opt.MaxActive; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 5, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := time.Minute, opt.ReapInterval; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := time.Minute, opt.HealthCheckInterval; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 1, opt.Shards; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// runtime changes are reflected
+	p.SetMaxCap(20)
+	p.SetConnMaxIdleTime(time.Hour)
+	p.SetReapInterval(time.Second)
+
+	opt = p.Options()
+	if exp, got := 20, opt.MaxCap; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := time.Hour, opt.IdleTimeout; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := time.Second, opt.ReapInterval; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_InitialSize_error(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	var n, closed int32
+	_, err := pool.New(&pool.Options{
+		InitialSize: 5,
+		OnClose:     func(net.Conn, error) { atomic.AddInt32(&closed, 1) },
+	}, func() (net.Conn, error) {
+		if atomic.AddInt32(&n, 1) == 3 {
+			return nil, errors.New("dial failed")
+		}
+		return factory()
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if exp, got := int32(4), atomic.LoadInt32(&closed); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestNewPassthrough(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p := pool.NewPassthrough(factory)
+	defer p.Close()
+
+	var prev net.Conn
+	for i := 0; i < 3; i++ {
+		cn, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cn == prev {
+			t.Error("expected a new connection")
+		}
+		if p.Put(cn) {
+			t.Error("expected false")
+		}
+		if exp, got := 0, p.Len(); exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+		if _, err := cn.Write([]byte("x")); err == nil {
+			t.Error("expected connection to be closed")
+		}
+		prev = cn
+	}
+
+	if exp, got := uint64(3), p.Stats().Misses; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestNewContext(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	var created, closed int32
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := pool.NewContext(ctx, &pool.Options{
+		InitialSize: 5,
+		OnClose:     func(net.Conn, error) { atomic.AddInt32(&closed, 1) },
+	}, func() (net.Conn, error) {
+		if atomic.AddInt32(&created, 1) > 2 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return factory()
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if exp, got := atomic.LoadInt32(&created), atomic.LoadInt32(&closed); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_IdleTimeout(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		InitialSize:  3,
+		IdleTimeout:  50 * time.Millisecond,
+		ReapInterval: 10 * time.Millisecond,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if exp, got := 3, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_IdleTimeout_sincePut(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		InitialSize:  1,
+		IdleTimeout:  40 * time.Millisecond,
+		ReapInterval: 5 * time.Millisecond,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	// hold the connection for longer than IdleTimeout
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	p.Put(cn)
+
+	// idleness is measured from Put
+	time.Sleep(10 * time.Millisecond)
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_ReapNow(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize:  3,
+		IdleTimeout:  10 * time.Millisecond,
+		ReapInterval: time.Hour,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if exp, got := 0, p.ReapNow(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 3, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if exp, got := 3, p.ReapNow(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := uint64(3), p.Stats().Reaped; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// no-op once closed
+	p.Put(new(mockCloser))
+	_ = p.Close()
+	if exp, got := 0, p.ReapNow(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_ReapNow_clock(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_000_000, 0)}
+	opt := &pool.OptionsOf[*mockCloser]{
+		InitialSize:  2,
+		IdleTimeout:  time.Minute,
+		MaxLifetime:  time.Hour,
+		ReapInterval: time.Hour,
+	}
+	pool.SetClock(opt, clock.Now)
+
+	p, err := pool.NewOf(opt, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	clock.Advance(59 * time.Second)
+	if exp, got := 0, p.ReapNow(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p.Put(cn)
+
+	// only the untouched connection is idle for long enough
+	clock.Advance(time.Second)
+	if exp, got := 1, p.ReapNow(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// lifetime is measured from creation
+	cn, err = p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	clock.Advance(time.Hour)
+	if p.Put(cn) {
+		t.Error("expected expired connection to be closed")
+	}
+}
+
+func TestPool_ReapNow_oldestFirst(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_000_000, 0)}
+	opt := &pool.OptionsOf[*mockCloser]{
+		MinIdle:      2,
+		IdleTimeout:  time.Minute,
+		ReapInterval: time.Hour,
+	}
+	pool.SetClock(opt, clock.Now)
+
+	p, err := pool.NewOf(opt, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	// returned one second apart, items[0] is the oldest
+	items := []*mockCloser{new(mockCloser), new(mockCloser), new(mockCloser)}
+	for _, c := range items {
+		p.Put(c)
+		clock.Advance(time.Second)
+	}
+	clock.Advance(time.Minute)
+
+	if exp, got := 1, p.ReapNow(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	for i, c := range items {
+		if exp, got := i == 0, c.IsClosed(); exp != got {
+			t.Errorf("expected item #%d closed to be %v, got %v", i, exp, got)
+		}
+	}
+}
+
+func TestOf_oldestFirst_shards(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		shrink func(t *testing.T, p *pool.Of[*mockCloser], clock *fakeClock)
+	}{
+		{"ReapNow", func(t *testing.T, p *pool.Of[*mockCloser], clock *fakeClock) {
+			clock.Advance(time.Minute)
+			if exp, got := 2, p.ReapNow(); exp != got {
+				t.Errorf("expected %v, got %v", exp, got)
+			}
+		}},
+		{"SetMaxCap", func(_ *testing.T, p *pool.Of[*mockCloser], _ *fakeClock) {
+			p.SetMaxCap(2)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := &fakeClock{t: time.Unix(1_000_000, 0)}
+			opt := &pool.OptionsOf[*mockCloser]{
+				MinIdle:      2,
+				IdleTimeout:  time.Minute,
+				ReapInterval: time.Hour,
+				Shards:       2,
+			}
+			pool.SetClock(opt, clock.Now)
+
+			p, err := pool.NewOf(opt, func() (*mockCloser, error) { return new(mockCloser), nil })
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			defer p.Close()
+
+			// returned one second apart and spread across both shards,
+			// items[0] is the oldest
+			items := []*mockCloser{new(mockCloser), new(mockCloser), new(mockCloser), new(mockCloser)}
+			for _, c := range items {
+				p.Put(c)
+				clock.Advance(time.Second)
+			}
+			if exp, got := 2, p.LenShard(0); exp != got {
+				t.Fatalf("expected %v, got %v", exp, got)
+			}
+
+			tc.shrink(t, p, clock)
+			for i, c := range items {
+				if exp, got := i < 2, c.IsClosed(); exp != got {
+					t.Errorf("expected item #%d closed to be %v, got %v", i, exp, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPool_SetConnMaxIdleTime(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		InitialSize:  2,
+		ReapInterval: 10 * time.Millisecond,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	time.Sleep(30 * time.Millisecond)
+	if exp, got := 2, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	p.SetConnMaxIdleTime(20 * time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_SetReapInterval(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		IdleTimeout:  10 * time.Millisecond,
+		ReapInterval: time.Hour,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	p.Put(new(mockCloser))
+	time.Sleep(30 * time.Millisecond)
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	p.SetReapInterval(0) // ignored
+	p.SetReapInterval(10 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// no-op once closed
+	_ = p.Close()
+	p.SetReapInterval(time.Second)
+}
+
+func TestPool_noBackgroundLoop(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	pools := make([]*pool.Of[*mockCloser], 0, 20)
+	for i := 0; i < 20; i++ {
+		p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+			InitialSize: 2,
+		}, func() (*mockCloser, error) { return new(mockCloser), nil })
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		pools = append(pools, p)
+	}
+
+	if delta := runtime.NumGoroutine() - before; delta >= 5 {
+		t.Errorf("expected no background goroutines, got %d", delta)
+	}
+
+	for _, p := range pools {
+		cn, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		p.Put(cn)
+
+		done := make(chan error, 1)
+		go func() { done <- p.Close() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected Close to return")
+		}
+		if exp, got := 0, p.Len(); exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+	}
+}
+
+func TestPool_MaxLifetime(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		InitialSize: 1,
+		MaxLifetime: 40 * time.Millisecond,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn1, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !p.Put(cn1) {
+		t.Error("expected true")
+	}
+
+	// reused within the lifetime window
+	cn2, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cn1 != cn2 {
+		t.Error("expected connection to be reused")
+	}
+	if !p.Put(cn2) {
+		t.Error("expected true")
+	}
+
+	// freshly dialed after the window
+	time.Sleep(50 * time.Millisecond)
+	cn3, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cn3.Close()
+
+	if cn1 == cn3 {
+		t.Error("expected a fresh connection")
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_MaxActive(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		MaxActive: 2,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn1, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cn2, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cn2.Close()
+
+	res := make(chan net.Conn, 1)
+	go func() {
+		cn, err := p.Get()
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		res <- cn
+	}()
+
+	select {
+	case <-res:
+		t.Fatal("expected Get to block")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if !p.Put(cn1) {
+		t.Error("expected true")
+	}
+
+	select {
+	case cn3 := <-res:
+		if cn1 != cn3 {
+			t.Error("expected returned connection to be reused")
+		}
+		_ = cn3.Close()
+	case <-time.After(time.Second):
+		t.Fatal("expected Get to unblock")
+	}
+}
+
+func TestPool_MaxActive_fifo(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MaxActive: 1,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	type result struct {
+		id int
+		cn *mockCloser
+	}
+	results := make(chan result, 5)
+	for i := 0; i < 5; i++ {
+		go func(id int) {
+			cn, err := p.Get()
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			results <- result{id: id, cn: cn}
+		}(i)
+		time.Sleep(10 * time.Millisecond) // queue in order
+	}
+
+	for i := 0; i < 5; i++ {
+		p.Put(cn)
+
+		res := <-results
+		if exp, got := i, res.id; exp != got {
+			t.Errorf("expected waiter #%v, got #%v", exp, got)
+		}
+		if res.cn != cn {
+			t.Error("expected the returned connection to be handed over")
+		}
+		cn = res.cn
+	}
+	p.Put(cn)
+
+	if exp, got := uint64(5), p.Stats().WaitCount; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_MaxActive_handoff(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MaxActive: 1,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	res := make(chan *mockCloser, 1)
+	go func() {
+		cn, err := p.Get()
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		res <- cn
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// the connection must skip the idle list
+	if !p.Put(cn) {
+		t.Fatal("expected true")
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if got := <-res; got != cn {
+		t.Error("expected the returned connection to be handed over")
+	}
+	if exp, got := 1, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	p.Put(cn)
+}
+
+func TestPool_NoWait(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		MaxActive: 1,
+		NoWait:    true,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := p.Get(); !errors.Is(err, pool.ErrPoolExhausted) {
+		t.Errorf("expected %v, got %v", pool.ErrPoolExhausted, err)
+	}
+
+	p.Put(cn)
+	cn, err = p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p.Put(cn)
+}
+
+func TestPool_WaitTimeout(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		MaxActive:   1,
+		WaitTimeout: 20 * time.Millisecond,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Put(cn)
+
+	start := time.Now()
+	if _, err := p.Get(); !errors.Is(err, pool.ErrPoolExhausted) {
+		t.Errorf("expected %v, got %v", pool.ErrPoolExhausted, err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected Get to give up after ~20ms, took %v", elapsed)
+	}
+	if exp, got := uint64(1), p.Stats().Timeouts; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestOf_WaitTimeout_slowDial(t *testing.T) {
+	for _, maxActive := range []int{0, 1} {
+		p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+			MaxActive:   maxActive,
+			WaitTimeout: 20 * time.Millisecond,
+			FactoryContext: func(ctx context.Context) (*mockCloser, error) {
+				select {
+				case <-time.After(50 * time.Millisecond):
+					return new(mockCloser), nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			},
+		}, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		// the timeout only bounds the wait for MaxActive, not the dial
+		cn, err := p.Get()
+		if err != nil {
+			t.Errorf("expected no error with MaxActive %v, got %v", maxActive, err)
+		} else {
+			p.Put(cn)
+		}
+		_ = p.Close()
+	}
+}
+
+func TestPool_MaxWaiters(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MaxActive:  1,
+		MaxWaiters: 2,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cn, err := p.Get()
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+				return
+			}
+			p.Put(cn)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := p.Get(); err != pool.ErrTooManyWaiters {
+		t.Errorf("expected %v, got %v", pool.ErrTooManyWaiters, err)
+	}
+	if exp, got := uint64(0), p.Stats().Timeouts; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	p.Put(cn)
+	wg.Wait()
+
+	// waiters are accepted again
+	cn, err = p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p.Put(cn)
+}
+
+func TestPool_GetN(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{MaxActive: 4}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	ctx := context.Background()
+	conns, err := p.GetN(ctx, 3)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 3, len(conns); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 3, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// a second batch can't be satisfied, partial acquisitions are returned
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := p.GetN(short, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if exp, got := 3, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	for _, cn := range conns {
+		p.Put(cn)
+	}
+
+	if _, err := p.GetN(ctx, 5); !errors.Is(err, pool.ErrPoolExhausted) {
+		t.Errorf("expected %v, got %v", pool.ErrPoolExhausted, err)
+	}
+	for _, n := range []int{0, -1} {
+		if _, err := p.GetN(ctx, n); err == nil {
+			t.Errorf("expected error for %v", n)
+		}
+	}
+}
+
+func TestPool_GetN_queued(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{MaxActive: 2}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	// hold one token, so the first batch blocks while holding the other
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	blocked := make(chan error, 1)
+	go func() {
+		_, err := p.GetN(ctx, 2)
+		blocked <- err
+	}()
+	for p.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	short, cancelShort := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelShort()
+
+	start := time.Now()
+	if _, err := p.GetN(short, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected queued batch to give up, took %v", elapsed)
+	}
+
+	cancel()
+	if err := <-blocked; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	p.Put(cn)
+}
+
+func TestPool_GetN_concurrent(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{MaxActive: 4}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 20; j++ {
+				conns, err := p.GetN(context.Background(), 3)
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+					return
+				}
+				for _, cn := range conns {
+					p.Put(cn)
+				}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected batches not to deadlock")
+	}
+}
+
+func TestPool_Active(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		InitialSize: 1,
+		MaxCap:      2,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if exp, got := 0, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	var cns []net.Conn
+	for i := 0; i < 4; i++ {
+		cn, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cns = append(cns, cn)
+	}
+	if exp, got := 4, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// the third is discarded over cap
+	for _, cn := range cns[:3] {
+		p.Put(cn)
+	}
+	if exp, got := 1, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 2, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// wrapped, unusable
+	wrapped, err := p.GetWrapped()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 2, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	wrapped.MarkUnusable()
+	_ = wrapped.Release()
+	if exp, got := 1, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	p.Put(cns[3])
+	if exp, got := 0, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_MaxCap_MaxActive(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	var closed int32
+	p, err := pool.New(&pool.Options{
+		MaxCap:    2,
+		MaxActive: 5,
+		OnClose:   func(_ net.Conn, _ error) { atomic.AddInt32(&closed, 1) },
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	var cns []net.Conn
+	for i := 0; i < 5; i++ {
+		cn, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cns = append(cns, cn)
+	}
+
+	var retained int
+	for _, cn := range cns {
+		if p.Put(cn) {
+			retained++
+		}
+	}
+	if exp, got := 2, retained; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 2, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := int32(3), atomic.LoadInt32(&closed); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_GetContext(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		MaxActive: 1,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.GetContext(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := p.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected prompt cancellation, took %v", elapsed)
+	}
+
+	// the cancelled call must not hold on to a slot
+	if !p.Put(cn) {
+		t.Error("expected true")
+	}
+	cn, err = p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_ = cn.Close()
+}
+
+func TestPool_MaxUses(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		MaxUses: 3,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	first, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p.Put(first)
+
+	for i := 2; i <= 3; i++ {
+		cn, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cn != first {
+			t.Errorf("expected borrow #%d to reuse the connection", i)
+		}
+		p.Put(cn)
+	}
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cn.Close()
+
+	if cn == first {
+		t.Error("expected borrow #4 to be a new connection")
+	}
+}
+
+func TestPool_FactoryContext(t *testing.T) {
+	server, _ := mockServer()
+	defer server.Close()
+
+	var dials int32
+	p, err := pool.New(&pool.Options{
+		FactoryContext: func(ctx context.Context) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return (&net.Dialer{}).DialContext(ctx, "tcp", server.Listener.Addr().String())
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := p.GetContext(ctx); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if exp, got := int32(1), atomic.LoadInt32(&dials); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_FactoryContext_deadline(t *testing.T) {
+	p, err := pool.New(&pool.Options{
+		FactoryContext: func(ctx context.Context) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := p.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected prompt cancellation, took %v", elapsed)
+	}
+}
+
+func TestPool_MaxRetries(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	var attempts int32
+	p, err := pool.New(&pool.Options{
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+	}, func() (net.Conn, error) {
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			return nil, errors.New("dial failed")
+		}
+		return factory()
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cn.Close()
+
+	if exp, got := int32(3), atomic.LoadInt32(&attempts); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_MaxRetries_exhausted(t *testing.T) {
+	var attempts int32
+	errDial := errors.New("dial failed")
+	p, err := pool.New(&pool.Options{
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	}, func() (net.Conn, error) {
+		atomic.AddInt32(&attempts, 1)
+		return nil, errDial
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if _, err := p.Get(); !errors.Is(err, errDial) {
+		t.Errorf("expected %v, got %v", errDial, err)
+	}
+	if exp, got := int32(3), atomic.LoadInt32(&attempts); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_MaxRetries_cancel(t *testing.T) {
+	var attempts int32
+	p, err := pool.New(&pool.Options{
+		MaxRetries:   5,
+		RetryBackoff: time.Second,
+	}, func() (net.Conn, error) {
+		atomic.AddInt32(&attempts, 1)
+		return nil, errors.New("dial failed")
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := p.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the backoff to be interrupted, took %v", elapsed)
+	}
+	if exp, got := int32(1), atomic.LoadInt32(&attempts); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_FailureThreshold(t *testing.T) {
+	var dials int32
+	var down atomic.Value
+	down.Store(true)
+
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		FailureThreshold: 2,
+		BreakerCooldown:  30 * time.Millisecond,
+	}, func() (*mockCloser, error) {
+		atomic.AddInt32(&dials, 1)
+		if down.Load().(bool) {
+			return nil, errors.New("connection refused")
+		}
+		return new(mockCloser), nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := p.Get(); err == nil || errors.Is(err, pool.ErrCircuitOpen) {
+			t.Fatalf("expected dial error, got %v", err)
+		}
+	}
+
+	// the circuit is open, no more dials
+	if _, err := p.Get(); !errors.Is(err, pool.ErrCircuitOpen) {
+		t.Errorf("expected %v, got %v", pool.ErrCircuitOpen, err)
+	}
+	if exp, got := int32(2), atomic.LoadInt32(&dials); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// a failed trial re-opens it
+	time.Sleep(40 * time.Millisecond)
+	if _, err := p.Get(); err == nil || errors.Is(err, pool.ErrCircuitOpen) {
+		t.Fatalf("expected dial error, got %v", err)
+	}
+	if _, err := p.Get(); !errors.Is(err, pool.ErrCircuitOpen) {
+		t.Errorf("expected %v, got %v", pool.ErrCircuitOpen, err)
+	}
+
+	// a successful trial closes it
+	down.Store(false)
+	time.Sleep(40 * time.Millisecond)
+	c, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p.Put(c)
+
+	down.Store(true)
+	if _, err := p.Get(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := p.Get(); err == nil || errors.Is(err, pool.ErrCircuitOpen) {
+		t.Fatalf("expected dial error, got %v", err)
+	}
+}
+
+func TestPool_TestOnBorrow(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	var tested int
+	p, err := pool.New(&pool.Options{
+		InitialSize: 2,
+		TestOnBorrow: func(_ net.Conn, lastAccess time.Time) error {
+			if lastAccess.IsZero() {
+				t.Error("expected lastAccess to be set")
+			}
+			tested++
+			return errors.New("rejected")
+		},
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn1, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 2, tested; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if !p.Put(cn1) {
+		t.Error("expected true")
+	}
+
+	cn2, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cn2.Close()
+
+	if cn1 == cn2 {
+		t.Error("expected a fresh connection")
+	}
+	if exp, got := 3, tested; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_OnReturn(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		OnReturn: func(cn net.Conn) error {
+			return cn.SetDeadline(time.Time{})
+		},
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := cn.SetDeadline(time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !p.Put(cn) {
+		t.Fatal("expected true")
+	}
+
+	cn, err = p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cn.Close()
+
+	if _, err := cn.Write([]byte("GET / HTTP/1.0\r\n\r\n")); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	// failing hooks discard the connection
+	failing, err := pool.New(&pool.Options{
+		OnReturn: func(net.Conn) error { return errors.New("dirty") },
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer failing.Close()
+
+	cn, err = failing.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if failing.Put(cn) {
+		t.Error("expected false")
+	}
+	if exp, got := 0, failing.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_SetFactory(t *testing.T) {
+	var oldDials, newDials int32
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize: 2,
+	}, func() (*mockCloser, error) {
+		atomic.AddInt32(&oldDials, 1)
+		return new(mockCloser), nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	// swap while dialing concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 10; j++ {
+				cn, err := p.Get()
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+					return
+				}
+				_ = p.PutErr(cn, io.EOF)
+			}
+		}()
+	}
+	p.SetFactory(func() (*mockCloser, error) {
+		atomic.AddInt32(&newDials, 1)
+		return new(mockCloser), nil
+	})
+	wg.Wait()
+
+	if err := p.Flush(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	oldBefore, newBefore := atomic.LoadInt32(&oldDials), atomic.LoadInt32(&newDials)
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p.Put(cn)
+
+	if exp, got := oldBefore, atomic.LoadInt32(&oldDials); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := newBefore+1, atomic.LoadInt32(&newDials); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_Info(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		InitialSize: 1,
+		FactoryInfo: func(context.Context) (net.Conn, pool.ConnInfo, error) {
+			cn, err := factory()
+			if err != nil {
+				return nil, nil, err
+			}
+			return cn, pool.ConnInfo{"addr": cn.RemoteAddr().String()}, nil
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	addr := server.Listener.Addr().String()
+	for i := 0; i < 2; i++ {
+		cn1, err := p.Get() // idle
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cn2, err := p.Get() // dialed
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		for _, cn := range []net.Conn{cn1, cn2} {
+			info, ok := p.Info(cn)
+			if !ok {
+				t.Fatal("expected info")
+			}
+			if exp, got := addr, info["addr"]; exp != got {
+				t.Errorf("expected %v, got %v", exp, got)
+			}
+		}
+
+		p.Put(cn2)
+		p.Put(cn1)
+		if _, ok := p.Info(cn1); ok {
+			t.Error("expected no info for idle connections")
+		}
+	}
+}
+
+func TestPool_GetFunc(t *testing.T) {
+	var created int32
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize: 3,
+		MaxActive:   3,
+	}, func() (*mockCloser, error) {
+		atomic.AddInt32(&created, 1)
+		return new(mockCloser), nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	var items []*mockCloser
+	for i := 0; i < 3; i++ {
+		c, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		items = append(items, c)
+	}
+	for _, c := range items {
+		p.Put(c)
+	}
+
+	// matching idle connections are preferred
+	c, err := p.GetFunc(func(c *mockCloser) bool { return c == items[1] })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if c != items[1] {
+		t.Error("expected the matching connection")
+	}
+	if exp, got := 2, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	p.Put(c)
+
+	// without a match, an idle connection makes room for a new one
+	fresh, err := p.GetFunc(func(*mockCloser) bool { return false })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, c := range items {
+		if c == fresh {
+			t.Error("expected a new connection")
+		}
+	}
+	if exp, got := int32(4), atomic.LoadInt32(&created); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 2, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if !items[0].IsClosed() {
+		t.Error("expected the oldest idle connection to be closed")
+	}
+	p.Put(fresh)
+}
+
+func TestOf_StrictOwnership_MaxActive(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MaxActive:       2,
+		NoWait:          true,
+		StrictOwnership: true,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	// a foreign connection must not add a slot beyond MaxActive
+	if p.Put(new(mockCloser)) {
+		t.Error("expected false")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := p.Get(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	if _, err := p.Get(); err != pool.ErrPoolExhausted {
+		t.Errorf("expected %v, got %v", pool.ErrPoolExhausted, err)
+	}
+	if exp, got := 2, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_StrictOwnership(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		StrictOwnership: true,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	foreign := new(mockCloser)
+	if p.Put(foreign) {
+		t.Error("expected false")
+	}
+	if !foreign.IsClosed() {
+		t.Error("expected foreign connection to be closed")
+	}
+	if exp, got := 1, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	if !p.Put(cn) {
+		t.Error("expected true")
+	}
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_OnGet(t *testing.T) {
+	var hits []bool
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		OnGet: func(_ *mockCloser, hit bool) { hits = append(hits, hit) },
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p.Put(cn)
+
+	cn, err = p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p.Put(cn)
+
+	if _, ok := p.TryGet(); !ok {
+		t.Fatal("expected an idle connection")
+	}
+	if _, ok := p.TryGet(); ok {
+		t.Fatal("expected no idle connection")
+	}
+
+	if exp, got := []bool{false, true, true}, hits; !reflect.DeepEqual(exp, got) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_Reset(t *testing.T) {
+	p, err := pool.NewOf(nil, func() (*resetCloser, error) { return new(resetCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !p.Put(cn) {
+		t.Fatal("expected true")
+	}
+	if exp, got := int32(1), atomic.LoadInt32(&cn.resets); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// failed resets discard the connection
+	cn, err = p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cn.fail = true
+	if p.Put(cn) {
+		t.Error("expected false")
+	}
+	if exp, got := int32(2), atomic.LoadInt32(&cn.resets); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if !cn.IsClosed() {
+		t.Error("expected connection to be closed")
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_KeepDeadlines(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	for _, keep := range []bool{false, true} {
+		p, err := pool.New(&pool.Options{
+			KeepDeadlines: keep,
+		}, factory)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer p.Close()
+
+		cn, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := cn.SetDeadline(time.Now().Add(-time.Second)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		p.Put(cn)
+
+		cn, err = p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer cn.Close()
+
+		_, err = cn.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+		if keep && err == nil {
+			t.Error("expected deadline to be kept")
+		} else if !keep && err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	}
+}
+
+func TestPool_OnClose(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	var closed int32
+	p, err := pool.New(&pool.Options{
+		InitialSize:  2,
+		MaxCap:       2,
+		IdleTimeout:  30 * time.Millisecond,
+		ReapInterval: 10 * time.Millisecond,
+		OnClose: func(_ net.Conn, err error) {
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			atomic.AddInt32(&closed, 1)
+		},
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// borrowing must not trigger the hook
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := int32(0), atomic.LoadInt32(&closed); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	p.Put(cn)
+
+	// reap both
+	time.Sleep(80 * time.Millisecond)
+	if exp, got := int32(2), atomic.LoadInt32(&closed); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// close the rest
+	for i := 0; i < 2; i++ {
+		cn, err := factory()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		p.Put(cn)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := int32(4), atomic.LoadInt32(&closed); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_TryGet(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	var rejected int
+	p, err := pool.New(&pool.Options{
+		InitialSize: 2,
+		TestOnBorrow: func(_ net.Conn, _ time.Time) error {
+			if rejected == 0 {
+				rejected++
+				return errors.New("rejected")
+			}
+			return nil
+		},
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	// hit, skips the first invalid connection
+	cn, ok := p.TryGet()
+	if !ok {
+		t.Fatal("expected a connection")
+	}
+	defer cn.Close()
+
+	if exp, got := 1, rejected; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// miss
+	if _, ok := p.TryGet(); ok {
+		t.Error("expected no connection")
+	}
+	if exp, got := uint64(0), p.Stats().Misses; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_Drain(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		InitialSize: 2,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// times out while the connection is checked out
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if _, err := p.Get(); err != pool.ErrPoolDraining {
+		t.Errorf("expected %v, got %v", pool.ErrPoolDraining, err)
+	}
+
+	// completes once the connection is returned
+	errs := make(chan error, 1)
+	go func() { errs <- p.Drain(context.Background()) }()
+
+	time.Sleep(10 * time.Millisecond)
+	if p.Put(cn) {
+		t.Error("expected false")
+	}
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Drain to complete")
+	}
+}
+
+func TestOf_Drain_MinIdle(t *testing.T) {
+	var created int32
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MinIdle:      2,
+		ReapInterval: 5 * time.Millisecond,
+	}, func() (*mockCloser, error) {
+		atomic.AddInt32(&created, 1)
+		return new(mockCloser), nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.WaitForIdle(ctx, 2); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := p.Drain(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// the loop must not keep dialing connections that are closed right away
+	before := atomic.LoadInt32(&created)
+	time.Sleep(50 * time.Millisecond)
+	if exp, got := before, atomic.LoadInt32(&created); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_Logger(t *testing.T) {
+	logger := new(mockLogger)
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		IdleTimeout:  20 * time.Millisecond,
+		ReapInterval: 10 * time.Millisecond,
+		Logger:       logger,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	p.Put(new(mockCloser))
+	p.Put(new(mockCloser))
+
+	time.Sleep(60 * time.Millisecond)
+	if exp, got := []string{"pool: reaped 2 connection(s)"}, logger.Lines(); !reflect.DeepEqual(exp, got) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_Flush(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	var dials int32
+	p, err := pool.New(&pool.Options{
+		InitialSize: 3,
+	}, func() (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return factory()
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	out, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := p.Flush(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := int32(4), atomic.LoadInt32(&dials); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// checked-out connections can still be returned
+	if !p.Put(out) {
+		t.Error("expected true")
+	}
+	if !p.Put(cn) {
+		t.Error("expected true")
+	}
+	if exp, got := 2, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestOf_SetMaxCap_evicts(t *testing.T) {
+	var closed int32
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize: 4,
+		MaxCap:      4,
+		OnClose:     func(*mockCloser, error) { atomic.AddInt32(&closed, 1) },
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	p.SetMaxCap(2)
+	if exp, got := int32(2), atomic.LoadInt32(&closed); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 2, p.LenShard(0); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// freed slots can be used again
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := pool.Pooled, p.PutResult(cn); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := pool.DiscardedFull, p.PutResult(new(mockCloser)); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_SetMaxCap(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		InitialSize: 4,
+		MaxCap:      4,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	// shrink
+	p.SetMaxCap(2)
+	if exp, got := 2, p.MaxCap(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 2, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 2, p.LenShard(0); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// grow
+	p.SetMaxCap(5)
+	for i := 0; i < 4; i++ {
+		cn, err := factory()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		p.Put(cn)
+	}
+	if exp, got := 5, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// clamp
+	p.SetMaxCap(0)
+	if exp, got := 1, p.MaxCap(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_MinIdle(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		InitialSize:  3,
+		MinIdle:      3,
+		ReapInterval: 10 * time.Millisecond,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	for i := 0; i < 3; i++ {
+		cn, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer cn.Close()
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if exp, got := 3, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_MinIdle_InitialSize(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize:  2,
+		MinIdle:      5,
+		ReapInterval: 20 * time.Millisecond,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if exp, got := 2, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.WaitForIdle(ctx, 5); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// no more than the floor
+	time.Sleep(50 * time.Millisecond)
+	if exp, got := 5, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_PrewarmOnDrain(t *testing.T) {
+	var created int32
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize:    2,
+		PrewarmOnDrain: true,
+	}, func() (*mockCloser, error) {
+		atomic.AddInt32(&created, 1)
+		return new(mockCloser), nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	// not the last one yet
+	c1, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Put(c1)
+
+	time.Sleep(10 * time.Millisecond)
+	if exp, got := int32(2), atomic.LoadInt32(&created); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	c2, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Put(c2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.WaitForIdle(ctx, 1); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := int32(3), atomic.LoadInt32(&created); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_LazyInit(t *testing.T) {
+	var created int32
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize: 3,
+		LazyInit:    true,
+	}, func() (*mockCloser, error) {
+		atomic.AddInt32(&created, 1)
+		return new(mockCloser), nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if exp, got := int32(0), atomic.LoadInt32(&created); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.WaitForIdle(ctx, 2); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p.Put(cn)
+
+	if exp, got := 3, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := int32(3), atomic.LoadInt32(&created); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_MinIdle_reap(t *testing.T) {
+	var created int32
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MinIdle:      2,
+		IdleTimeout:  20 * time.Millisecond,
+		ReapInterval: 10 * time.Millisecond,
+	}, func() (*mockCloser, error) {
+		atomic.AddInt32(&created, 1)
+		return new(mockCloser), nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	var items []*mockCloser
+	for i := 0; i < 5; i++ {
+		c, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		items = append(items, c)
+	}
+	for _, c := range items {
+		p.Put(c)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	if exp, got := 2, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// the floor is kept, not refilled
+	if exp, got := int32(5), atomic.LoadInt32(&created); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	for i, c := range items {
+		if exp, got := i < 3, c.IsClosed(); exp != got {
+			t.Errorf("expected item #%d closed to be %v, got %v", i, exp, got)
+		}
+	}
+}
+
+func TestPool_AutoScale(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MaxCap:       8,
+		MinIdle:      1,
+		AutoScale:    true,
+		ReapInterval: 5 * time.Millisecond,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if exp, got := 1, p.MinIdle(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// keep borrowing without returning, so most Gets have to dial
+	for deadline := time.Now().Add(time.Second); p.MinIdle() < 4 && time.Now().Before(deadline); {
+		c, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		_ = c.Close()
+		time.Sleep(100 * time.Microsecond)
+	}
+	if got := p.MinIdle(); got < 4 {
+		t.Fatalf("expected floor to rise to at least 4, got %v", got)
+	}
+
+	// without traffic, the floor goes back to MinIdle
+	for deadline := time.Now().Add(time.Second); p.MinIdle() > 1 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if exp, got := 1, p.MinIdle(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_PutErr(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{InitialSize: 1}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if p.PutErr(cn, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}) {
+		t.Error("expected false")
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 0, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if _, err := cn.Write([]byte("x")); err == nil {
+		t.Error("expected connection to be closed")
+	}
+
+	cn, err = p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !p.PutErr(cn, nil) {
+		t.Error("expected true")
+	}
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_PutResult(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{MaxCap: 1}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn1, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cn2, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := pool.Pooled, p.PutResult(cn1); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := pool.DiscardedFull, p.PutResult(cn2); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := pool.DiscardedInvalid, p.PutResult(nil); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := pool.DiscardedClosed, p.PutResult(cn); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	q, err := pool.New(&pool.Options{
+		OnReturn: func(net.Conn) error { return errors.New("dirty") },
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer q.Close()
+
+	cn, err = q.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := pool.DiscardedInvalid, q.PutResult(cn); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 0, q.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_With(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{InitialSize: 1}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	var borrowed net.Conn
+	if err := p.With(context.Background(), func(cn net.Conn) error {
+		borrowed = cn
+		if exp, got := 1, p.Active(); exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 0, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	var errBroken error = &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+	if err := p.With(context.Background(), func(cn net.Conn) error {
+		if cn != borrowed {
+			t.Error("expected the idle connection to be reused")
+		}
+		return errBroken
+	}); err != errBroken {
+		t.Errorf("expected %v, got %v", errBroken, err)
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 0, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if _, err := borrowed.Write([]byte("x")); err == nil {
+		t.Error("expected connection to be closed")
+	}
+}
+
+func TestPool_With_panic(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(nil, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("expected panic, got %v", r)
+			}
+		}()
+		_ = p.With(context.Background(), func(net.Conn) error { panic("boom") })
+	}()
+
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 0, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_PutErr_appError(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{InitialSize: 1}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	for _, err := range []error{errors.New("not found"), nil} {
+		cn, e := p.Get()
+		if e != nil {
+			t.Fatalf("expected no error, got %v", e)
+		}
+		if !p.PutErr(cn, err) {
+			t.Errorf("expected true for %v", err)
+		}
+	}
+	for _, err := range []error{io.EOF, fmt.Errorf("read: %w", io.ErrClosedPipe), net.ErrClosed} {
+		cn, e := p.Get()
+		if e != nil {
+			t.Fatalf("expected no error, got %v", e)
+		}
+		if p.PutErr(cn, err) {
+			t.Errorf("expected false for %v", err)
+		}
+	}
+}
+
+func TestPool_IsBadConn(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	errNotFound := errors.New("not found")
+	p, err := pool.New(&pool.Options{
+		InitialSize: 1,
+		IsBadConn: func(err error) bool {
+			var ne net.Error
+			return errors.As(err, &ne)
+		},
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	var kept net.Conn
+	if err := p.With(context.Background(), func(cn net.Conn) error {
+		kept = cn
+		return errNotFound
+	}); err != errNotFound {
+		t.Errorf("expected %v, got %v", errNotFound, err)
+	}
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	var errTimeout error = &net.OpError{Op: "read", Net: "tcp", Err: errors.New("i/o timeout")}
+	if err := p.With(context.Background(), func(cn net.Conn) error {
+		if cn != kept {
+			t.Error("expected the connection to be kept")
+		}
+		return errTimeout
+	}); err != errTimeout {
+		t.Errorf("expected %v, got %v", errTimeout, err)
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if _, err := kept.Write([]byte("x")); err == nil {
+		t.Error("expected connection to be closed")
+	}
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !p.PutErr(cn, io.EOF) {
+		t.Error("expected true")
+	}
+}
+
+func TestPool_Put_nil(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{InitialSize: 1}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if p.Put(nil) {
+		t.Error("expected false")
+	}
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	q, err := pool.NewOf(nil, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer q.Close()
+
+	if q.Put((*mockCloser)(nil)) {
+		t.Error("expected false")
+	}
+	if exp, got := 0, q.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_factoryNil(t *testing.T) {
+	p, err := pool.New(nil, func() (net.Conn, error) { return nil, nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if _, err := p.Get(); !errors.Is(err, pool.ErrNilConn) {
+		t.Fatalf("expected %v, got %v", pool.ErrNilConn, err)
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// typed nil pointers, during warmup
+	_, err = pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize: 2,
+	}, func() (*mockCloser, error) { return nil, nil })
+	if !errors.Is(err, pool.ErrNilConn) {
+		t.Errorf("expected %v, got %v", pool.ErrNilConn, err)
+	}
+}
+
+func TestPool_FillTo(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{MaxCap: 8}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	ctx := context.Background()
+	if err := p.FillTo(ctx, 5); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 5, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// bounded by MaxCap
+	if err := p.FillTo(ctx, 20); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 8, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// already there
+	if err := p.FillTo(ctx, 3); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 8, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_FillTo_cancel(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{MaxActive: 2}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cn.Close()
+
+	// only one slot is left, waiting for the second one times out
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := p.FillTo(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if exp, got := 1, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_FillTo_Close(t *testing.T) {
+	var created, closed int32
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MaxCap:    50,
+		MaxActive: 50,
+		OnClose:   func(_ *mockCloser, _ error) { atomic.AddInt32(&closed, 1) },
+	}, func() (*mockCloser, error) {
+		atomic.AddInt32(&created, 1)
+		time.Sleep(time.Millisecond)
+		return new(mockCloser), nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- p.FillTo(context.Background(), 50) }()
+
+	time.Sleep(500 * time.Microsecond)
+	if err := p.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	<-done
+
+	// every created item is closed eventually
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if atomic.LoadInt32(&created) == atomic.LoadInt32(&closed) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if exp, got := atomic.LoadInt32(&created), atomic.LoadInt32(&closed); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_WaitForIdle(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		MinIdle:      3,
+		ReapInterval: 10 * time.Millisecond,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := p.WaitForIdle(ctx, 3); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := p.Len(); got < 3 {
+		t.Errorf("expected at least 3, got %v", got)
+	}
+
+	// MaxCap is never exceeded
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	if err := p.WaitForIdle(ctx, 11); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestPool_factoryError(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	p, err := pool.New(nil, func() (net.Conn, error) {
+		return nil, errRefused
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	_, err = p.Get()
+	if !errors.Is(err, errRefused) {
+		t.Errorf("expected %v, got %v", errRefused, err)
+	}
+	if exp, got := "pool: dial failed: connection refused", err.Error(); exp != got {
+		t.Errorf("expected %q, got %q", exp, got)
+	}
+	if errors.Is(err, pool.ErrPoolClosed) {
+		t.Errorf("expected %v not to be %v", err, pool.ErrPoolClosed)
+	}
+}
+
+func TestPool_factoryPanic(t *testing.T) {
+	p, err := pool.New(nil, func() (net.Conn, error) {
+		panic("boom")
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if _, err := p.Get(); !errors.Is(err, pool.ErrFactoryPanic) {
+		t.Errorf("expected %v, got %v", pool.ErrFactoryPanic, err)
+	}
+}
+
+func TestPool_Close(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	var n int32
+	p, err := pool.New(&pool.Options{
+		InitialSize: 3,
+	}, func() (net.Conn, error) {
+		cn, err := factory()
+		if err != nil {
+			return nil, err
+		}
+		return &failingConn{Conn: cn, err: fmt.Errorf("close failed #%d", atomic.AddInt32(&n, 1))}, nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = p.Close()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for i := 1; i <= 3; i++ {
+		if exp := fmt.Sprintf("close failed #%d", i); !strings.Contains(err.Error(), exp) {
+			t.Errorf("expected %q to contain %q", err.Error(), exp)
+		}
+	}
+
+	// closing again is a no-op
+	if err := p.Close(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestPool_Close_reaping(t *testing.T) {
+	var mu sync.Mutex
+	var conns []*slowCloser
+	p, err := pool.NewOf(&pool.OptionsOf[*slowCloser]{
+		InitialSize:  10,
+		IdleTimeout:  time.Millisecond,
+		ReapInterval: 5 * time.Millisecond,
+	}, func() (*slowCloser, error) {
+		cn := &slowCloser{delay: 5 * time.Millisecond}
+		mu.Lock()
+		conns = append(conns, cn)
+		mu.Unlock()
+		return cn, nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// close while the first reap cycle is still closing connections
+	time.Sleep(15 * time.Millisecond)
+	if err := p.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if exp, got := 10, len(conns); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	for i, cn := range conns {
+		if exp, got := int32(1), atomic.LoadInt32(&cn.closes); exp != got {
+			t.Errorf("expected conn #%d to be closed %v time(s), got %v", i, exp, got)
+		}
+	}
+}
+
+func TestPool_CloseTimeout(t *testing.T) {
+	stuck := &slowCloser{delay: 500 * time.Millisecond}
+	p, err := pool.NewOf(&pool.OptionsOf[*slowCloser]{
+		CloseTimeout: 20 * time.Millisecond,
+	}, func() (*slowCloser, error) { return stuck, nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p.Put(cn)
+
+	start := time.Now()
+	if err := p.Close(); !errors.Is(err, pool.ErrCloseTimeout) {
+		t.Errorf("expected %v, got %v", pool.ErrCloseTimeout, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Close to give up after ~20ms, took %v", elapsed)
+	}
+}
+
+func TestPool_CloseContext(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize: 2,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		p.Put(cn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.CloseContext(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !cn.IsClosed() {
+		t.Error("expected returned connection to be closed")
+	}
+	if exp, got := 0, p.Active(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if _, err := p.Get(); err != pool.ErrPoolClosed {
+		t.Errorf("expected %v, got %v", pool.ErrPoolClosed, err)
+	}
+}
+
+func TestPool_CloseContext_timeout(t *testing.T) {
+	p, err := pool.NewOf(nil, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.CloseContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if _, err := p.Get(); err != pool.ErrPoolClosed {
+		t.Errorf("expected %v, got %v", pool.ErrPoolClosed, err)
+	}
+}
+
+func TestPool_Close_Get(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{InitialSize: 1}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := p.Get(); !errors.Is(err, pool.ErrPoolClosed) {
+		t.Errorf("expected %v, got %v", pool.ErrPoolClosed, err)
+	}
+	if p.Put(cn) {
+		t.Error("expected Put to return false")
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_Close_noDial(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	var dials int32
+	p, err := pool.New(nil, func() (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return factory()
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := p.Get(); !errors.Is(err, pool.ErrPoolClosed) {
+		t.Errorf("expected %v, got %v", pool.ErrPoolClosed, err)
+	}
+	if exp, got := int32(0), atomic.LoadInt32(&dials); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_Close_wakesWaiters(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{MaxActive: 1}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cn.Close()
+
+	res := make(chan error, 1)
+	go func() {
+		_, err := p.Get()
+		res <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := p.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	select {
+	case err := <-res:
+		if !errors.Is(err, pool.ErrPoolClosed) {
+			t.Errorf("expected %v, got %v", pool.ErrPoolClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Get to unblock")
+	}
+}
+
+func TestOf(t *testing.T) {
+	var created []*mockCloser
+	factory := func() (*mockCloser, error) {
+		c := new(mockCloser)
+		created = append(created, c)
+		return c, nil
+	}
+
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		IdleTimeout:  30 * time.Millisecond,
+		ReapInterval: 10 * time.Millisecond,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := p.Get(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	for _, c := range created {
+		if !p.Put(c) {
+			t.Error("expected true")
+		}
+	}
+
+	c, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if c != created[1] {
+		t.Error("expected most recent item to be returned")
+	}
+	if !p.Put(c) {
+		t.Error("expected true")
+	}
+	if exp, got := 2, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	for i, c := range created {
+		if !c.IsClosed() {
+			t.Errorf("expected item #%d to be closed", i)
+		}
+	}
+}
+
+func TestOf_FIFO(t *testing.T) {
+	for _, fifo := range []bool{false, true} {
+		p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+			FIFO: fifo,
+		}, func() (*mockCloser, error) { return new(mockCloser), nil })
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		items := []*mockCloser{new(mockCloser), new(mockCloser), new(mockCloser)}
+		for _, c := range items {
+			p.Put(c)
+		}
+
+		exp := []*mockCloser{items[2], items[1], items[0]}
+		if fifo {
+			exp = items
+		}
+		for i := range exp {
+			c, err := p.Get()
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if c != exp[i] {
+				t.Errorf("fifo=%v: expected item #%d to be %p, got %p", fifo, i, exp[i], c)
+			}
+		}
+		p.Close()
+	}
+}
+
+func TestOf_concurrent(t *testing.T) {
+	var created, closed int32
+	factory := func() (*mockCloser, error) {
+		atomic.AddInt32(&created, 1)
+		return new(mockCloser), nil
+	}
+
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MaxCap:  8,
+		OnClose: func(_ *mockCloser, _ error) { atomic.AddInt32(&closed, 1) },
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 1000; j++ {
+				c, err := p.Get()
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+					return
+				}
+				if !atomic.CompareAndSwapInt32(&c.inUse, 0, 1) {
+					t.Error("expected item to be handed out only once")
+				}
+				atomic.StoreInt32(&c.inUse, 0)
+				p.Put(c)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every item is either idle or closed
+	if exp, got := int(atomic.LoadInt32(&created)-atomic.LoadInt32(&closed)), p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestOf_Shards(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MaxCap: 8,
+		Shards: 4,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	var items []*mockCloser
+	for i := 0; i < 10; i++ {
+		c, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		items = append(items, c)
+	}
+	for _, c := range items {
+		p.Put(c)
+	}
+
+	// the cap applies across all shards
+	if exp, got := 8, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// idle items are found on any shard
+	for i := 0; i < 8; i++ {
+		c, ok := p.TryGet()
+		if !ok {
+			t.Fatalf("expected item #%d, got none", i)
+		}
+		if c.IsClosed() {
+			t.Errorf("expected item #%d to be open", i)
+		}
+	}
+	if exp, got := 0, p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestOf_Shards_concurrent(t *testing.T) {
+	var created, closed int32
+	factory := func() (*mockCloser, error) {
+		atomic.AddInt32(&created, 1)
+		return new(mockCloser), nil
+	}
+
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MaxCap:  16,
+		Shards:  8,
+		OnClose: func(_ *mockCloser, _ error) { atomic.AddInt32(&closed, 1) },
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 1000; j++ {
+				c, err := p.Get()
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+					return
+				}
+				if !atomic.CompareAndSwapInt32(&c.inUse, 0, 1) {
+					t.Error("expected item to be handed out only once")
+				}
+				atomic.StoreInt32(&c.inUse, 0)
+				p.Put(c)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if exp, got := int(atomic.LoadInt32(&created)-atomic.LoadInt32(&closed)), p.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if max, got := 16, p.Len(); got > max {
+		t.Errorf("expected at most %v, got %v", max, got)
+	}
+}
+
+func TestOf_Shards_Len(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MaxCap: 4,
+		Shards: 4,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	done := make(chan struct{})
+	checked := make(chan struct{})
+	go func() {
+		defer close(checked)
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if n := p.Len(); n < 0 || n > 4 {
+				t.Errorf("expected 0 <= Len() <= 4, got %v", n)
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 1000; j++ {
+				c1, err := p.Get()
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+					return
+				}
+				c2, err := p.Get()
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+					return
+				}
+				p.Put(c1)
+				p.Put(c2)
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-checked
+
+	sum := 0
+	for i := 0; i < 4; i++ {
+		sum += p.LenShard(i)
+	}
+	if exp, got := p.Len(), sum; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 0, p.LenShard(4); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestOf_Put_concurrent(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MaxCap: 4,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	for round := 0; round < 50; round++ {
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < 32; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				p.Put(new(mockCloser))
+				if max, got := 4, p.Len(); got > max {
+					t.Errorf("expected at most %v, got %v", max, got)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		if exp, got := 4, p.Len(); exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+		for p.Len() != 0 {
+			c, _ := p.TryGet()
+			_ = c.Close()
+		}
+	}
+}
+
 // --------------------------------------------------------------------
 
 func mockServer() (*httptest.Server, pool.Factory) {
@@ -89,3 +3479,147 @@ func BenchmarkPool(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkOf_shards(b *testing.B) {
+	for _, n := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("shards=%d", n), func(b *testing.B) {
+			p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+				MaxCap: 64,
+				Shards: n,
+			}, func() (*mockCloser, error) { return new(mockCloser), nil })
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer p.Close()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					c, err := p.Get()
+					if err != nil {
+						b.Fatal(err)
+					}
+					p.Put(c)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkOf_MaxActive_contended(b *testing.B) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MaxActive: 2,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer p.Close()
+
+	b.SetParallelism(8)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c, err := p.Get()
+			if err != nil {
+				b.Fatal(err)
+			}
+			p.Put(c)
+		}
+	})
+}
+
+func BenchmarkOf_allocs(b *testing.B) {
+	p, err := pool.NewOf(nil, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer p.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c, err := p.Get()
+		if err != nil {
+			b.Fatal(err)
+		}
+		p.Put(c)
+	}
+}
+
+type mockCloser struct{ closed, inUse int32 }
+
+func (c *mockCloser) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+func (c *mockCloser) IsClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+type resetCloser struct {
+	mockCloser
+	resets int32
+	fail   bool
+}
+
+func (c *resetCloser) Reset() error {
+	atomic.AddInt32(&c.resets, 1)
+	if c.fail {
+		return errors.New("reset failed")
+	}
+	return nil
+}
+
+type fakeClock struct {
+	t  time.Time
+	mu sync.Mutex
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+type slowCloser struct {
+	delay  time.Duration
+	closes int32
+}
+
+func (c *slowCloser) Close() error {
+	time.Sleep(c.delay)
+	atomic.AddInt32(&c.closes, 1)
+	return nil
+}
+
+type mockLogger struct {
+	lines []string
+	mu    sync.Mutex
+}
+
+func (l *mockLogger) Printf(format string, args ...any) {
+	l.mu.Lock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+	l.mu.Unlock()
+}
+
+func (l *mockLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+type failingConn struct {
+	net.Conn
+	err error
+}
+
+func (c *failingConn) Close() error {
+	_ = c.Conn.Close()
+	return c.err
+}
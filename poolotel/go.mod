@@ -0,0 +1,20 @@
+module github.com/bsm/pool/poolotel
+
+go 1.20
+
+require (
+	github.com/bsm/pool v0.0.0-20261014160418-420640164995
+	go.opentelemetry.io/otel v1.19.0
+	go.opentelemetry.io/otel/sdk v1.19.0
+	go.opentelemetry.io/otel/trace v1.19.0
+)
+
+require (
+	github.com/go-logr/logr v1.2.4 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel/metric v1.19.0 // indirect
+	golang.org/x/sys v0.12.0 // indirect
+)
+
+// Develop against the parent module, consumers resolve the version above.
+replace github.com/bsm/pool => ../
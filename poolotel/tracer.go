@@ -0,0 +1,47 @@
+// Package poolotel adds OpenTelemetry tracing to pool operations.
+package poolotel
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/bsm/pool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/bsm/pool/poolotel"
+
+// Tracer traces pool operations.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// WithTracer creates a Tracer using the given provider.
+func WithTracer(tp trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: tp.Tracer(instrumentationName)}
+}
+
+// Get calls GetContext on the pool within a "pool.Get" span, a child of the
+// span in ctx. The span records whether the item was served from the pool,
+// the time spent waiting and any error.
+func Get[T io.Closer](ctx context.Context, t *Tracer, p *pool.Of[T]) (T, error) {
+	ctx, span := t.tracer.Start(ctx, "pool.Get")
+	defer span.End()
+
+	ctx = pool.WithGetTrace(ctx, &pool.GetTrace{
+		GetDone: func(hit bool, wait time.Duration, err error) {
+			span.SetAttributes(
+				attribute.Bool("pool.hit", hit),
+				attribute.Int64("pool.wait_us", wait.Microseconds()),
+			)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+		},
+	})
+	return p.GetContext(ctx)
+}
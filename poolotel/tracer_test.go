@@ -0,0 +1,84 @@
+package poolotel_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bsm/pool"
+	"github.com/bsm/pool/poolotel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestGet(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	tracer := poolotel.WithTracer(tp)
+
+	fail := false
+	p, err := pool.NewOf(nil, func() (*mockCloser, error) {
+		if fail {
+			return nil, errors.New("dial failed")
+		}
+		return new(mockCloser), nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+
+	// miss, then hit
+	for i := 0; i < 2; i++ {
+		c, err := poolotel.Get(ctx, tracer, p)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		p.Put(c)
+	}
+
+	// error
+	_, _ = p.Get()
+	fail = true
+	if _, err := poolotel.Get(ctx, tracer, p); err == nil {
+		t.Fatal("expected error")
+	}
+	parent.End()
+
+	spans := rec.Ended()
+	if exp, got := 4, len(spans); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	for i, exp := range []bool{false, true, false} {
+		span := spans[i]
+		if exp, got := "pool.Get", span.Name(); exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+		if exp, got := parent.SpanContext().SpanID(), span.Parent().SpanID(); exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+		if got := hitAttr(span.Attributes()); exp != got {
+			t.Errorf("expected span #%d hit=%v, got %v", i, exp, got)
+		}
+	}
+	if exp, got := codes.Error, spans[2].Status().Code; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func hitAttr(attrs []attribute.KeyValue) bool {
+	for _, kv := range attrs {
+		if kv.Key == "pool.hit" {
+			return kv.Value.AsBool()
+		}
+	}
+	return false
+}
+
+type mockCloser struct{}
+
+func (*mockCloser) Close() error { return nil }
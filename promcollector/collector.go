@@ -0,0 +1,53 @@
+// Package promcollector exports pool statistics as Prometheus metrics.
+package promcollector
+
+import (
+	"github.com/bsm/pool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// StatsSource is implemented by *pool.Pool and *pool.Of.
+type StatsSource interface {
+	Stats() pool.Stats
+}
+
+// Collector implements prometheus.Collector.
+type Collector struct {
+	src StatsSource
+
+	idle, active, hits, misses, timeouts, reaped *prometheus.Desc
+}
+
+// New creates a new collector for the given pool.
+func New(src StatsSource, namespace string) *Collector {
+	return &Collector{
+		src:      src,
+		idle:     prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "idle_connections"), "Number of idle connections.", nil, nil),
+		active:   prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "active_connections"), "Number of checked-out connections.", nil, nil),
+		hits:     prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "hits_total"), "Number of times a connection was served from the pool.", nil, nil),
+		misses:   prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "misses_total"), "Number of times a new connection was created.", nil, nil),
+		timeouts: prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "timeouts_total"), "Number of times a caller gave up waiting.", nil, nil),
+		reaped:   prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", "reaped_total"), "Number of connections closed by the reaper.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.idle
+	ch <- c.active
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.reaped
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	st := c.src.Stats()
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(st.Idle))
+	ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(st.Active))
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(st.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(st.Misses))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(st.Timeouts))
+	ch <- prometheus.MustNewConstMetric(c.reaped, prometheus.CounterValue, float64(st.Reaped))
+}
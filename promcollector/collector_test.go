@@ -0,0 +1,62 @@
+package promcollector_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bsm/pool"
+	"github.com/bsm/pool/promcollector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize: 2,
+	}, func() (*mockCloser, error) {
+		return new(mockCloser), nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	c, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Put(c)
+
+	collector := promcollector.New(p, "test")
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(collector); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if exp, got := 6, testutil.CollectAndCount(collector); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	exp := `
+# HELP test_pool_active_connections Number of checked-out connections.
+# TYPE test_pool_active_connections gauge
+test_pool_active_connections 1
+# HELP test_pool_hits_total Number of times a connection was served from the pool.
+# TYPE test_pool_hits_total counter
+test_pool_hits_total 1
+# HELP test_pool_idle_connections Number of idle connections.
+# TYPE test_pool_idle_connections gauge
+test_pool_idle_connections 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(exp),
+		"test_pool_active_connections",
+		"test_pool_hits_total",
+		"test_pool_idle_connections",
+	); err != nil {
+		t.Error(err)
+	}
+}
+
+type mockCloser struct{}
+
+func (*mockCloser) Close() error { return nil }
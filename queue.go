@@ -0,0 +1,134 @@
+package pool
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// grant is handed to a waiting Get. It either carries a returned member or,
+// if conn is false, the MaxActive token of a discarded connection.
+type grant[T io.Closer] struct {
+	m    member[T]
+	conn bool
+}
+
+// wait queues the caller behind all other waiting Get calls and blocks
+// until it is handed a member or a MaxActive token. It returns retry if
+// idle connections became available before the caller was queued. It fails
+// with ErrTooManyWaiters if MaxWaiters are already queued.
+func (s *Of[T]) wait(ctx context.Context) (g grant[T], retry bool, err error) {
+	s.waitMu.Lock()
+	select {
+	case s.sem <- none{}:
+		s.waitMu.Unlock()
+		return g, false, nil
+	default:
+	}
+	if s.Len() != 0 {
+		s.waitMu.Unlock()
+		return g, true, nil
+	}
+	if limit := s.opt.MaxWaiters; limit > 0 && len(s.waiters) >= limit {
+		s.waitMu.Unlock()
+		return g, false, ErrTooManyWaiters
+	}
+
+	w := make(chan grant[T], 1)
+	s.waiters = append(s.waiters, w)
+	atomic.AddInt32(&s.waiting, 1)
+	s.waitMu.Unlock()
+
+	select {
+	case g = <-w:
+		return g, false, nil
+	case <-s.dying:
+		err = ErrPoolClosed
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	s.leave(w)
+	return grant[T]{}, false, err
+}
+
+// waitTimeout is like wait, but gives up with ErrPoolExhausted once the total
+// wait exceeds a positive timeout, counting the time already waited.
+func (s *Of[T]) waitTimeout(ctx context.Context, timeout, waited time.Duration) (grant[T], bool, error) {
+	if timeout <= 0 {
+		return s.wait(ctx)
+	}
+	if waited >= timeout {
+		return grant[T]{}, false, ErrPoolExhausted
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout-waited)
+	defer cancel()
+
+	g, retry, err := s.wait(ctx)
+	if err == context.DeadlineExceeded {
+		err = ErrPoolExhausted
+	}
+	return g, retry, err
+}
+
+// leave removes an aborted waiter from the queue. If it was handed a grant
+// in the meantime, the grant is passed on.
+func (s *Of[T]) leave(w chan grant[T]) {
+	s.waitMu.Lock()
+	for i, x := range s.waiters {
+		if x == w {
+			copy(s.waiters[i:], s.waiters[i+1:])
+			s.waiters[len(s.waiters)-1] = nil
+			s.waiters = s.waiters[:len(s.waiters)-1]
+			atomic.AddInt32(&s.waiting, -1)
+			s.waitMu.Unlock()
+			return
+		}
+	}
+	s.waitMu.Unlock()
+
+	// grants are sent while holding the lock, so it must be there
+	if g := <-w; g.conn {
+		s.restore(g.m)
+	} else {
+		s.release()
+	}
+}
+
+// dequeue removes the longest waiting Get from the queue. Must hold waitMu.
+func (s *Of[T]) dequeue() (chan grant[T], bool) {
+	if len(s.waiters) == 0 {
+		return nil, false
+	}
+
+	w := s.waiters[0]
+	s.waiters[0] = nil
+	s.waiters = s.waiters[1:]
+	atomic.AddInt32(&s.waiting, -1)
+	return w, true
+}
+
+// stash hands a member to the longest waiting Get or adds it to the idle
+// list, preserving the order by lastAccess if insert is set. It returns true
+// if the member was handed off. The caller must have reserved a slot, which
+// is released again on hand-off.
+func (s *Of[T]) stash(m member[T], insert bool) bool {
+	if s.sem != nil {
+		s.waitMu.Lock()
+		defer s.waitMu.Unlock()
+
+		if w, ok := s.dequeue(); ok {
+			atomic.AddInt32(&s.size, -1)
+			w <- grant[T]{m: m, conn: true}
+			return true
+		}
+	}
+
+	if insert {
+		s.shard().insert(m)
+	} else {
+		s.shard().push(m)
+	}
+	return false
+}
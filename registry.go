@@ -0,0 +1,51 @@
+package pool
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var registry = struct {
+	pools map[string]*Pool
+	mu    sync.RWMutex
+}{pools: make(map[string]*Pool)}
+
+// Register registers a pool under a name, replacing (but not closing) any
+// pool previously registered under the same name.
+func Register(name string, p *Pool) {
+	registry.mu.Lock()
+	registry.pools[name] = p
+	registry.mu.Unlock()
+}
+
+// Lookup returns the pool registered under name.
+func Lookup(name string) (*Pool, bool) {
+	registry.mu.RLock()
+	p, ok := registry.pools[name]
+	registry.mu.RUnlock()
+	return p, ok
+}
+
+// CloseAll closes all registered pools, in order of their names, and clears
+// the registry. It returns all errors encountered, joined.
+func CloseAll() error {
+	registry.mu.Lock()
+	pools := registry.pools
+	registry.pools = make(map[string]*Pool)
+	registry.mu.Unlock()
+
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if err := pools[name].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,79 @@
+package pool_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/bsm/pool"
+)
+
+func TestRegister(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+	defer pool.CloseAll()
+
+	p1, err := pool.New(nil, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p1.Close()
+
+	p2, err := pool.New(nil, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, ok := pool.Lookup("svc"); ok {
+		t.Error("expected no pool")
+	}
+
+	pool.Register("svc", p1)
+	if got, ok := pool.Lookup("svc"); !ok || got != p1 {
+		t.Errorf("expected %p, got %p", p1, got)
+	}
+
+	// registering again replaces the pool
+	pool.Register("svc", p2)
+	if got, ok := pool.Lookup("svc"); !ok || got != p2 {
+		t.Errorf("expected %p, got %p", p2, got)
+	}
+}
+
+func TestCloseAll(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p1, err := pool.New(&pool.Options{InitialSize: 1}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p2, err := pool.New(&pool.Options{InitialSize: 1}, func() (net.Conn, error) {
+		cn, err := factory()
+		if err != nil {
+			return nil, err
+		}
+		return &failingConn{Conn: cn, err: errors.New("close failed")}, nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	pool.Register("a", p1)
+	pool.Register("b", p2)
+
+	if err := pool.CloseAll(); err == nil || err.Error() != "close failed" {
+		t.Errorf("expected close failed, got %v", err)
+	}
+	if _, err := p1.Get(); !errors.Is(err, pool.ErrPoolClosed) {
+		t.Errorf("expected %v, got %v", pool.ErrPoolClosed, err)
+	}
+	if _, ok := pool.Lookup("a"); ok {
+		t.Error("expected registry to be cleared")
+	}
+
+	// closing again is a no-op
+	if err := pool.CloseAll(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
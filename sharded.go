@@ -0,0 +1,94 @@
+package pool
+
+import (
+	"errors"
+	"hash/fnv"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// shardReplicas is the number of points per shard on the hash ring.
+const shardReplicas = 128
+
+// ShardedPool routes connections to one of several pools by key, using
+// consistent hashing. The same key always maps to the same pool, and adding
+// or removing a shard only remaps the keys of that shard.
+type ShardedPool struct {
+	pools  map[string]*Pool
+	points []uint64
+	owners map[uint64]*Pool
+}
+
+// NewSharded creates a sharded pool. Pools are identified by name; the
+// names, not the order, determine the placement of keys.
+func NewSharded(pools map[string]*Pool) (*ShardedPool, error) {
+	if len(pools) == 0 {
+		return nil, errors.New("pool: no pools")
+	}
+
+	sp := &ShardedPool{
+		pools:  pools,
+		points: make([]uint64, 0, len(pools)*shardReplicas),
+		owners: make(map[uint64]*Pool, len(pools)*shardReplicas),
+	}
+	for name, p := range pools {
+		for i := 0; i < shardReplicas; i++ {
+			h := hashKey([]byte(name + "#" + strconv.Itoa(i)))
+			if _, ok := sp.owners[h]; ok {
+				continue // collision, first one wins
+			}
+			sp.owners[h] = p
+			sp.points = append(sp.points, h)
+		}
+	}
+	sort.Slice(sp.points, func(i, j int) bool { return sp.points[i] < sp.points[j] })
+	return sp, nil
+}
+
+// ShardFor returns the pool responsible for key.
+func (sp *ShardedPool) ShardFor(key []byte) *Pool {
+	h := hashKey(key)
+	i := sort.Search(len(sp.points), func(i int) bool { return sp.points[i] >= h })
+	if i == len(sp.points) {
+		i = 0
+	}
+	return sp.owners[sp.points[i]]
+}
+
+// GetFor returns a connection from the pool responsible for key.
+func (sp *ShardedPool) GetFor(key []byte) (net.Conn, error) {
+	return sp.ShardFor(key).Get()
+}
+
+// PutFor returns a connection to the pool responsible for key. The key must
+// be the one the connection was obtained with.
+func (sp *ShardedPool) PutFor(key []byte, cn net.Conn) bool {
+	return sp.ShardFor(key).Put(cn)
+}
+
+// Close closes all pools. It returns all errors encountered, joined.
+func (sp *ShardedPool) Close() error {
+	var errs []error
+	for _, p := range sp.pools {
+		if err := p.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hashKey hashes a key with FNV-1a, followed by the murmur3 finalizer, as
+// FNV alone distributes similar keys poorly across the ring.
+func hashKey(key []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(key)
+
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
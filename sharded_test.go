@@ -0,0 +1,104 @@
+package pool_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bsm/pool"
+)
+
+func TestShardedPool(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	pools := make(map[string]*pool.Pool)
+	for _, name := range []string{"a", "b", "c"} {
+		p, err := pool.New(nil, factory)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		pools[name] = p
+	}
+
+	sp, err := pool.NewSharded(pools)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer sp.Close()
+
+	// keys map consistently
+	key := []byte("customer-42")
+	shard := sp.ShardFor(key)
+	for i := 0; i < 10; i++ {
+		if got := sp.ShardFor(key); got != shard {
+			t.Fatalf("expected %p, got %p", shard, got)
+		}
+	}
+
+	cn, err := sp.GetFor(key)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !sp.PutFor(key, cn) {
+		t.Error("expected true")
+	}
+	if exp, got := 1, shard.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// keys are spread reasonably
+	counts := make(map[*pool.Pool]int)
+	for i := 0; i < 3000; i++ {
+		counts[sp.ShardFor([]byte(fmt.Sprintf("key-%d", i)))]++
+	}
+	for name, p := range pools {
+		if n := counts[p]; n < 600 || n > 1400 {
+			t.Errorf("expected shard %s to get around 1000 keys, got %d", name, n)
+		}
+	}
+}
+
+func TestShardedPool_rebalance(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	pools := make(map[string]*pool.Pool)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		p, err := pool.New(nil, factory)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer p.Close()
+		pools[name] = p
+	}
+
+	sp4, err := pool.NewSharded(pools)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	sp3, err := pool.NewSharded(map[string]*pool.Pool{"a": pools["a"], "b": pools["b"], "c": pools["c"]})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// adding a shard only moves keys to the new shard
+	moved := 0
+	for i := 0; i < 3000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		if before, after := sp3.ShardFor(key), sp4.ShardFor(key); before != after {
+			if after != pools["d"] {
+				t.Fatalf("expected key %s to move to the new shard", key)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 1200 {
+		t.Errorf("expected around 750 keys to move, got %d", moved)
+	}
+}
+
+func TestNewSharded_empty(t *testing.T) {
+	if _, err := pool.NewSharded(nil); err == nil {
+		t.Error("expected error")
+	}
+}
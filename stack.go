@@ -0,0 +1,181 @@
+package pool
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// stack is a mutex-guarded list of idle members. Members are pushed to and
+// popped from the end, so the list is ordered by lastAccess. It does not rely
+// on unsafe or lock-free tricks, so it is checked by go vet and the race
+// detector like any other code.
+type stack[T io.Closer] struct {
+	conns []member[T]
+	avail uint32
+	mu    sync.Mutex
+
+	_ [64]byte // avoid false sharing between shards
+}
+
+// Len returns the number of members.
+func (st *stack[T]) Len() int { return int(atomic.LoadUint32(&st.avail)) }
+
+// push appends a member.
+func (st *stack[T]) push(m member[T]) {
+	st.mu.Lock()
+	st.conns = append(st.conns, m)
+	st.sync()
+	st.mu.Unlock()
+}
+
+// pop removes the most recent member, or the oldest one if fifo is set.
+func (st *stack[T]) pop(fifo bool) (member[T], bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	pos := len(st.conns) - 1
+	if pos < 0 {
+		return member[T]{}, false
+	}
+
+	if fifo {
+		m := st.conns[0]
+		copy(st.conns, st.conns[1:])
+		st.truncate(pos)
+		return m, true
+	}
+
+	m := st.conns[pos]
+	st.conns[pos] = member[T]{}
+	st.conns = st.conns[:pos]
+	st.sync()
+	return m, true
+}
+
+// take removes the most recent member accepted by match, or the oldest one
+// if fifo is set.
+func (st *stack[T]) take(match func(T) bool, fifo bool) (member[T], bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	n := len(st.conns)
+	for j := 0; j < n; j++ {
+		i := n - 1 - j
+		if fifo {
+			i = j
+		}
+		if m := st.conns[i]; match(m.cn) {
+			copy(st.conns[i:], st.conns[i+1:])
+			st.truncate(n - 1)
+			return m, true
+		}
+	}
+	return member[T]{}, false
+}
+
+// insert adds a member, preserving the order by lastAccess.
+func (st *stack[T]) insert(m member[T]) {
+	st.mu.Lock()
+	pos := len(st.conns)
+	for pos > 0 && st.conns[pos-1].lastAccess.After(m.lastAccess) {
+		pos--
+	}
+	st.conns = append(st.conns, member[T]{})
+	copy(st.conns[pos+1:], st.conns[pos:])
+	st.conns[pos] = m
+	st.sync()
+	st.mu.Unlock()
+}
+
+// remove removes a specific member.
+func (st *stack[T]) remove(cn T) (member[T], bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for i, m := range st.conns {
+		if any(m.cn) == any(cn) {
+			copy(st.conns[i:], st.conns[i+1:])
+			st.truncate(len(st.conns) - 1)
+			return m, true
+		}
+	}
+	return member[T]{}, false
+}
+
+// shift removes up to n of the oldest members.
+func (st *stack[T]) shift(n int) []T {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if n > len(st.conns) {
+		n = len(st.conns)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	removed := make([]T, 0, n)
+	for _, m := range st.conns[:n] {
+		removed = append(removed, m.cn)
+	}
+	sz := copy(st.conns, st.conns[n:])
+	st.truncate(sz)
+	return removed
+}
+
+// filter removes all members matching the predicate, keeping the order
+// of the remaining ones intact.
+func (st *stack[T]) filter(drop func(member[T]) bool) []T {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var removed []T
+	n := 0
+	for _, m := range st.conns {
+		if drop(m) {
+			removed = append(removed, m.cn)
+			continue
+		}
+		st.conns[n] = m
+		n++
+	}
+	st.truncate(n)
+	return removed
+}
+
+// scan calls fn for each member, oldest first.
+func (st *stack[T]) scan(fn func(member[T])) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, m := range st.conns {
+		fn(m)
+	}
+}
+
+// snapshot returns all members.
+func (st *stack[T]) snapshot() []T {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	conns := make([]T, 0, len(st.conns))
+	for _, m := range st.conns {
+		conns = append(conns, m.cn)
+	}
+	return conns
+}
+
+// truncate shortens the list to n, clearing the tail. Must hold the lock.
+func (st *stack[T]) truncate(n int) {
+	for i := n; i < len(st.conns); i++ {
+		st.conns[i] = member[T]{}
+	}
+	st.conns = st.conns[:n]
+	st.sync()
+}
+
+// sync updates the avail counter. Must hold the lock.
+func (st *stack[T]) sync() {
+	atomic.StoreUint32(&st.avail, uint32(len(st.conns)))
+}
@@ -0,0 +1,114 @@
+package pool
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Stats contains pool statistics
+type Stats struct {
+	// Idle is the number of idle connections in the pool
+	Idle int
+	// Active is the number of connections currently checked out
+	Active int
+	// MaxCap is the maximum number of idle connections retained
+	MaxCap int
+
+	// Hits is the number of times Get was satisfied from the pool
+	Hits uint64
+	// Misses is the number of times Get had to create a new connection
+	Misses uint64
+	// Timeouts is the number of times Get gave up waiting due to
+	// context cancellation
+	Timeouts uint64
+
+	// Reaped is the number of connections closed by the reaper, because
+	// they exceeded IdleTimeout or MaxLifetime
+	Reaped uint64
+
+	// WaitCount is the total number of times Get had to wait for a
+	// connection due to MaxActive
+	WaitCount uint64
+	// WaitDuration is the total time spent waiting
+	WaitDuration time.Duration
+	// Waiting is the number of callers currently waiting for a connection
+	// due to MaxActive
+	Waiting int
+
+	// IdleHistogram counts the time connections spent idle before being
+	// handed out again, in buckets of <1ms, <10ms, <100ms, <1s, <10s, <1m
+	// and >=1m, only recorded when Options.IdleHistogram is set
+	IdleHistogram [7]uint64
+
+	// DroppedEvents is the number of events dropped because the Events
+	// channel was full
+	DroppedEvents uint64
+
+	// BytesRead and BytesWritten are the number of bytes transferred over
+	// borrowed connections, only counted when CountBytes is enabled
+	BytesRead, BytesWritten uint64
+}
+
+// Stats returns a snapshot of the pool statistics
+func (s *Of[T]) Stats() Stats {
+	var hist [7]uint64
+	for i := range hist {
+		hist[i] = atomic.LoadUint64(&s.idleHist[i])
+	}
+
+	return Stats{
+		Idle:   s.Len(),
+		Active: s.Active(),
+		MaxCap: s.MaxCap(),
+
+		Hits:     atomic.LoadUint64(&s.hits),
+		Misses:   atomic.LoadUint64(&s.misses),
+		Timeouts: atomic.LoadUint64(&s.timeouts),
+		Reaped:   atomic.LoadUint64(&s.reaped),
+
+		WaitCount:    atomic.LoadUint64(&s.waitCount),
+		WaitDuration: time.Duration(atomic.LoadInt64(&s.waitDuration)),
+		Waiting:      int(atomic.LoadInt32(&s.waiting)),
+
+		IdleHistogram: hist,
+		DroppedEvents: atomic.LoadUint64(&s.droppedEvents),
+
+		BytesRead:    atomic.LoadUint64(&s.bytesRead),
+		BytesWritten: atomic.LoadUint64(&s.bytesWritten),
+	}
+}
+
+// String formats the statistics for debugging.
+func (st Stats) String() string {
+	return fmt.Sprintf(
+		"idle=%d active=%d maxcap=%d "+
+			"hits=%d misses=%d timeouts=%d reaped=%d "+
+			"waits=%d waiting=%d wait=%s "+
+			"dropped=%d read=%d written=%d",
+		st.Idle, st.Active, st.MaxCap,
+		st.Hits, st.Misses, st.Timeouts, st.Reaped,
+		st.WaitCount, st.Waiting, st.WaitDuration,
+		st.DroppedEvents, st.BytesRead, st.BytesWritten,
+	)
+}
+
+// idleBuckets are the upper bounds of the IdleHistogram buckets, the last
+// bucket holds everything above.
+var idleBuckets = [...]time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+}
+
+// observeIdle records the idle time of a connection handed out by Get.
+func (s *Of[T]) observeIdle(d time.Duration) {
+	i := 0
+	for i < len(idleBuckets) && d >= idleBuckets[i] {
+		i++
+	}
+	atomic.AddUint64(&s.idleHist[i], 1)
+}
@@ -0,0 +1,253 @@
+package pool_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bsm/pool"
+)
+
+func TestPool_Stats(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		InitialSize: 1,
+		MaxCap:      2,
+		MaxActive:   3,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	// 1 hit, 2 misses
+	var cns []net.Conn
+	for i := 0; i < 3; i++ {
+		cn, err := p.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cns = append(cns, cn)
+	}
+
+	// 1 timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	if exp, got := (pool.Stats{
+		Idle:      0,
+		Active:    3,
+		MaxCap:    2,
+		Hits:      1,
+		Misses:    2,
+		Timeouts:  1,
+		WaitCount: 1,
+	}), statsWithoutDuration(p); exp != got {
+		t.Errorf("expected %+v, got %+v", exp, got)
+	}
+
+	for _, cn := range cns {
+		p.Put(cn)
+	}
+
+	if exp, got := (pool.Stats{
+		Idle:      2,
+		Active:    0,
+		MaxCap:    2,
+		Hits:      1,
+		Misses:    2,
+		Timeouts:  1,
+		WaitCount: 1,
+	}), statsWithoutDuration(p); exp != got {
+		t.Errorf("expected %+v, got %+v", exp, got)
+	}
+}
+
+func TestPool_Stats_wait(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(&pool.Options{
+		MaxActive: 1,
+	}, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	// instant acquisitions don't count
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := uint64(0), p.Stats().WaitCount; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		p.Put(cn)
+	}()
+
+	cn, err = p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer cn.Close()
+
+	st := p.Stats()
+	if exp, got := uint64(1), st.WaitCount; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if min, got := 10*time.Millisecond, st.WaitDuration; got < min {
+		t.Errorf("expected at least %v, got %v", min, got)
+	}
+}
+
+func TestPool_Stats_Waiting(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		MaxActive: 1,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	served := make(chan *mockCloser, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			cn, err := p.Get()
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			served <- cn
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	for i := 3; i > 0; i-- {
+		if exp, got := i, p.Stats().Waiting; exp != got {
+			t.Errorf("expected %v, got %v", exp, got)
+		}
+		p.Put(cn)
+		cn = <-served
+	}
+	p.Put(cn)
+
+	if exp, got := 0, p.Stats().Waiting; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPool_String(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		InitialSize: 3,
+		MaxCap:      5,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := p.Get(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if exp, got := "pool{idle=2 active=1 maxcap=5 closed=false}", p.String(); exp != got {
+		t.Errorf("expected %q, got %q", exp, got)
+	}
+	for _, exp := range []string{"idle=2", "active=1", "maxcap=5", "hits=1", "misses=0", "read=0", "written=0"} {
+		if got := p.Stats().String(); !strings.Contains(got, exp) {
+			t.Errorf("expected %q to contain %q", got, exp)
+		}
+	}
+
+	_ = p.Close()
+	if exp, got := "pool{idle=0 active=1 maxcap=5 closed=true}", fmt.Sprint(p); exp != got {
+		t.Errorf("expected %q, got %q", exp, got)
+	}
+}
+
+func statsWithoutDuration(p *pool.Pool) pool.Stats {
+	st := p.Stats()
+	st.WaitDuration = 0
+	st.IdleHistogram = [7]uint64{}
+	return st
+}
+
+func TestOf_Stats_reaped(t *testing.T) {
+	var closed int32
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		IdleTimeout:  10 * time.Millisecond,
+		ReapInterval: 5 * time.Millisecond,
+		OnClose:      func(_ *mockCloser, _ error) { atomic.AddInt32(&closed, 1) },
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 2; i++ {
+			p.Put(new(mockCloser))
+		}
+		time.Sleep(40 * time.Millisecond)
+	}
+
+	if exp, got := uint64(6), p.Stats().Reaped; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := uint64(atomic.LoadInt32(&closed)), p.Stats().Reaped; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestOf_Stats_IdleHistogram(t *testing.T) {
+	p, err := pool.NewOf(&pool.OptionsOf[*mockCloser]{
+		IdleHistogram: true,
+	}, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	for _, delay := range []time.Duration{0, 0, 20 * time.Millisecond, 150 * time.Millisecond} {
+		p.Put(new(mockCloser))
+		time.Sleep(delay)
+		if _, err := p.Get(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	if exp, got := [7]uint64{2, 0, 1, 1, 0, 0, 0}, p.Stats().IdleHistogram; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// not recorded by default
+	q, err := pool.NewOf(nil, func() (*mockCloser, error) { return new(mockCloser), nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer q.Close()
+
+	q.Put(new(mockCloser))
+	if _, err := q.Get(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := [7]uint64{}, q.Stats().IdleHistogram; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
@@ -0,0 +1,29 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+// GetTrace is a set of hooks to run during GetContext, it allows
+// instrumentation without adding dependencies to the pool itself.
+type GetTrace struct {
+	// GetDone is called when GetContext returns. It reports whether the
+	// connection was served from the pool, the time spent waiting for
+	// MaxActive and the returned error.
+	GetDone func(hit bool, wait time.Duration, err error)
+}
+
+type getTraceKey struct{}
+
+// WithGetTrace returns a context based on parent that runs the trace hooks
+// in GetContext.
+func WithGetTrace(parent context.Context, trace *GetTrace) context.Context {
+	return context.WithValue(parent, getTraceKey{}, trace)
+}
+
+// ContextGetTrace returns the GetTrace associated with the context or nil.
+func ContextGetTrace(ctx context.Context) *GetTrace {
+	trace, _ := ctx.Value(getTraceKey{}).(*GetTrace)
+	return trace
+}
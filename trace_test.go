@@ -0,0 +1,45 @@
+package pool_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bsm/pool"
+)
+
+func TestWithGetTrace(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(nil, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	var hits []bool
+	ctx := pool.WithGetTrace(context.Background(), &pool.GetTrace{
+		GetDone: func(hit bool, _ time.Duration, err error) {
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			hits = append(hits, hit)
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		cn, err := p.GetContext(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		p.Put(cn)
+	}
+
+	if exp, got := 2, len(hits); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if hits[0] || !hits[1] {
+		t.Errorf("expected [false true], got %v", hits)
+	}
+}
@@ -0,0 +1,113 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// WeightedPool distributes connections across several pools, proportionally
+// to their weights. It uses smooth weighted round-robin, so pools are
+// interleaved rather than used in bursts.
+type WeightedPool struct {
+	pools   []*Pool
+	weights []int
+	total   int
+
+	current []int
+	owners  map[net.Conn]*Pool
+	mu      sync.Mutex
+}
+
+// NewWeighted creates a weighted pool. Weights must be positive, one for
+// each pool.
+func NewWeighted(pools []*Pool, weights []int) (*WeightedPool, error) {
+	if len(pools) == 0 {
+		return nil, errors.New("pool: no pools")
+	}
+	if len(pools) != len(weights) {
+		return nil, errors.New("pool: number of weights does not match number of pools")
+	}
+
+	total := 0
+	for _, w := range weights {
+		if w <= 0 {
+			return nil, errors.New("pool: weights must be positive")
+		}
+		total += w
+	}
+
+	return &WeightedPool{
+		pools:   pools,
+		weights: weights,
+		total:   total,
+		current: make([]int, len(pools)),
+		owners:  make(map[net.Conn]*Pool),
+	}, nil
+}
+
+// Get returns a connection from the next pool.
+func (w *WeightedPool) Get() (net.Conn, error) {
+	return w.GetContext(context.Background())
+}
+
+// GetContext returns a connection from the next pool, see Of.GetContext.
+func (w *WeightedPool) GetContext(ctx context.Context) (net.Conn, error) {
+	p := w.next()
+	cn, err := p.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	w.owners[cn] = p
+	w.mu.Unlock()
+	return cn, nil
+}
+
+// Put returns a connection to the pool it was obtained from. Connections
+// not obtained from this pool are closed.
+func (w *WeightedPool) Put(cn net.Conn) bool {
+	if cn == nil {
+		return false
+	}
+
+	w.mu.Lock()
+	p, ok := w.owners[cn]
+	delete(w.owners, cn)
+	w.mu.Unlock()
+
+	if !ok {
+		_ = cn.Close()
+		return false
+	}
+	return p.Put(cn)
+}
+
+// Close closes all pools. It returns all errors encountered, joined.
+func (w *WeightedPool) Close() error {
+	var errs []error
+	for _, p := range w.pools {
+		if err := p.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// next selects the next pool, using smooth weighted round-robin.
+func (w *WeightedPool) next() *Pool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	best := 0
+	for i, weight := range w.weights {
+		w.current[i] += weight
+		if w.current[i] > w.current[best] {
+			best = i
+		}
+	}
+	w.current[best] -= w.total
+	return w.pools[best]
+}
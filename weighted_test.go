@@ -0,0 +1,74 @@
+package pool_test
+
+import (
+	"testing"
+
+	"github.com/bsm/pool"
+)
+
+func TestWeightedPool(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p1, err := pool.New(nil, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p2, err := pool.New(nil, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	w, err := pool.NewWeighted([]*pool.Pool{p1, p2}, []int{1, 2})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 300; i++ {
+		cn, err := w.Get()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !w.Put(cn) {
+			t.Error("expected true")
+		}
+	}
+
+	s1, s2 := p1.Stats(), p2.Stats()
+	if exp, got := uint64(100), s1.Hits+s1.Misses; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := uint64(200), s2.Hits+s2.Misses; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	// connections go back to where they came from
+	if exp, got := 1, p1.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 1, p2.Len(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestNewWeighted_invalid(t *testing.T) {
+	server, factory := mockServer()
+	defer server.Close()
+
+	p, err := pool.New(nil, factory)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer p.Close()
+
+	if _, err := pool.NewWeighted(nil, nil); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := pool.NewWeighted([]*pool.Pool{p}, []int{1, 2}); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := pool.NewWeighted([]*pool.Pool{p}, []int{0}); err == nil {
+		t.Error("expected error")
+	}
+}